@@ -14,45 +14,164 @@ type Block struct {
 	Difficulty   int    `json:"difficulty"`
 	Nonce        int    `json:"nonce"`
 	Timestamp    int    `json:"timestamp"`
+	MerkleRoot   string `json:"merkleRoot"`
+	WitnessRoot  string `json:"witnessRoot"`
 	Transactions []*Tx  `json:"transactions"`
 }
 
-func (b *Block) mine() {
-	difficulty := strings.Repeat("0", b.Difficulty)
-	for {
-		b.Timestamp = int(time.Now().Unix())
-		b.Hash = utils.Hash(b)
-		if strings.HasPrefix(b.Hash, difficulty) {
-			return
-		} else {
-			b.Nonce += 1
+// blockHeader is the part of a block covered by its hash. Transactions are
+// committed through MerkleRoot (ids) and WitnessRoot (witness hashes).
+type blockHeader struct {
+	PrevHash    string `json:"prevHash"`
+	Height      int    `json:"height"`
+	Difficulty  int    `json:"difficulty"`
+	Nonce       int    `json:"nonce"`
+	Timestamp   int    `json:"timestamp"`
+	MerkleRoot  string `json:"merkleRoot"`
+	WitnessRoot string `json:"witnessRoot"`
+}
+
+func (b *Block) header() blockHeader {
+	return blockHeader{
+		PrevHash:    b.PrevHash,
+		Height:      b.Height,
+		Difficulty:  b.Difficulty,
+		Nonce:       b.Nonce,
+		Timestamp:   b.Timestamp,
+		MerkleRoot:  b.MerkleRoot,
+		WitnessRoot: b.WitnessRoot,
+	}
+}
+
+func (b *Block) calcHash() string {
+	return utils.HashJson(b.header())
+}
+
+func (b *Block) meetsDifficulty() bool {
+	return strings.HasPrefix(b.Hash, strings.Repeat("0", b.Difficulty))
+}
+
+// verifyCommitments checks that the hash matches the header, meets the
+// difficulty and that the roots match the transactions.
+func (b *Block) verifyCommitments() bool {
+	if b.Hash != b.calcHash() || !b.meetsDifficulty() {
+		return false
+	}
+	for _, tx := range b.Transactions {
+		recalculated := *tx
+		recalculated.calcId()
+		recalculated.calcWitnessHash()
+		if tx.Id != recalculated.Id || tx.WitnessHash != recalculated.WitnessHash {
+			return false
 		}
 	}
+	merkleRoot, witnessRoot := txRoots(b.Transactions)
+	return b.MerkleRoot == merkleRoot && b.WitnessRoot == witnessRoot
 }
 
+// persistBlock stores the block, its header and undo data and applies it to
+// the UTXO set.
 func persistBlock(block *Block) {
-	storage.SaveBlock([]byte(block.Hash), utils.ToBytes(block))
+	undo, spent, created := utxoChanges(block)
+	storage.ConnectBlock([]byte(block.Hash), utils.ToBytes(block), utils.ToBytes(block.withoutTxs()), utils.ToBytes(undo), spent, created)
 }
 
-func createBlock(b *blockchain, height int, difficulty int) *Block {
+// markWalletOutputs tells each loaded wallet which of its addresses block
+// pays, so it keeps watching past them, watch-only ones too.
+func markWalletOutputs(block *Block) {
+	for _, wl := range w.Wallets() {
+		for _, tx := range block.Transactions {
+			for _, txOut := range tx.TxOuts {
+				if txOut.Address != "" && w.Watches(wl, txOut.Address) {
+					w.MarkUsed(wl, txOut.Address)
+				}
+			}
+		}
+	}
+}
+
+// withoutTxs is the block as stored in the headers bucket.
+func (b *Block) withoutTxs() *Block {
+	header := *b
+	header.Transactions = nil
+	return &header
+}
+
+// newBlockTemplate builds an unmined block on top of the current tip.
+func newBlockTemplate(b *blockchain, height int, difficulty int) *Block {
 	newBlock := &Block{
 		Hash:       "",
 		PrevHash:   b.LastHash,
 		Height:     height + 1,
 		Difficulty: difficulty,
 		Nonce:      0,
+		Timestamp:  int(time.Now().Unix()),
 	}
-	newBlock.mine()
-	newBlock.Transactions = getTxstoConfirm(b)
+	newBlock.Transactions = getTxstoConfirm(b, newBlock.Height)
+	newBlock.MerkleRoot, newBlock.WitnessRoot = txRoots(newBlock.Transactions)
 	return newBlock
 }
 
+func NewBlockTemplate(b *blockchain) *Block {
+	return newBlockTemplate(b, GetHeight(b), getDifficulty(b))
+}
+
+func createBlock(b *blockchain, height int, difficulty int) *Block {
+	newBlock := newBlockTemplate(b, height, difficulty)
+	newBlock.Mine(nil)
+	return newBlock
+}
+
+// genesisBlock is the first block of network p.
+func genesisBlock(p *chainParams) *Block {
+	coinbase := &Tx{
+		Timestamp: p.GenesisTime,
+		TxIns: []*TxIn{{
+			Address:  "Coinbase",
+			Index:    -1,
+			Coinbase: "1",
+		}},
+		TxOuts: []*TxOut{{
+			Address: p.GenesisAddress,
+			Amount:  minerReward,
+		}},
+	}
+	coinbase.calcId()
+	coinbase.calcWitnessHash()
+	genesis := &Block{
+		Height:       1,
+		Difficulty:   defaultDifficulty,
+		Nonce:        p.GenesisNonce,
+		Timestamp:    p.GenesisTime,
+		Transactions: []*Tx{coinbase},
+	}
+	genesis.MerkleRoot, genesis.WitnessRoot = txRoots(genesis.Transactions)
+	genesis.Hash = genesis.calcHash()
+	return genesis
+}
+
+// findHeader returns a block without its transactions, which is kept even
+// when the body was pruned.
+func findHeader(hash string) (*Block, error) {
+	header := &Block{}
+	headerAsB, err := storage.FindHeader([]byte(hash))
+	if err != nil {
+		return nil, err
+	}
+	if utils.DecodeBytes(header, headerAsB) != nil {
+		return nil, errCorruptData
+	}
+	return header, nil
+}
+
 func FindBlock(hash string) (*Block, error) {
 	block := &Block{}
 	hashedBlock, err := storage.FindBlock([]byte(hash))
 	if err != nil {
 		return nil, err
 	}
-	utils.FromBytes(block, hashedBlock)
+	if utils.DecodeBytes(block, hashedBlock) != nil {
+		return nil, errCorruptData
+	}
 	return block, nil
 }
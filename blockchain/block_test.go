@@ -12,29 +12,40 @@ type testWallet struct{}
 func (testWallet) Wallet() *wallet.W {
 	return &wallet.W{}
 }
-func (testWallet) Sign(hash string, w *wallet.W) string {
-	return "signature"
+func (w testWallet) Wallets() []*wallet.W {
+	return []*wallet.W{w.Wallet()}
 }
-func (testWallet) Verify(addr string, hash string, signature string) bool {
+func (testWallet) Owns(w *wallet.W, address string) bool {
+	return address == w.Address
+}
+func (testWallet) Watches(w *wallet.W, address string) bool {
+	return address == w.Address
+}
+func (testWallet) ChangeAddress(w *wallet.W) (string, error) {
+	return w.Address, nil
+}
+func (testWallet) ClaimChange(w *wallet.W, address string)   {}
+func (testWallet) ReleaseChange(w *wallet.W, address string) {}
+func (testWallet) MarkUsed(w *wallet.W, address string)      {}
+func (testWallet) Sign(hash string, w *wallet.W, address string) (string, error) {
+	return "signature", nil
+}
+func (testWallet) PublicKey(w *wallet.W, address string) (string, error) {
+	return "pubKey", nil
+}
+func (testWallet) Verify(addr string, pubKey string, hash string, signature string) bool {
 	return true
 }
 
 func TestCreateBlock(t *testing.T) {
 	w = testWallet{}
-	Mempool().Txs["test"] = &Tx{TxIns: []*TxIn{{TxId: "txId", Index: 0}}}
+	Mempool().Txs["test"] = &Tx{TxIns: []*TxIn{{TxId: "txId", Index: 0, SigHash: SigHashAll}}}
 	storage = testStorage{
 		fakeFindBlock: func(key []byte) ([]byte, error) {
-			block := &Block{
-				Transactions: []*Tx{
-					{
-						Id: "txId",
-						TxOuts: []*TxOut{
-							{},
-						},
-					},
-				},
-			}
-			return utils.ToBytes(block), nil
+			return utils.ToBytes(&Block{Height: 1}), nil
+		},
+		fakeFindUTxOut: func(key []byte) ([]byte, error) {
+			return utils.ToBytes(&TxOut{}), nil
 		},
 	}
 	tb := createBlock(&blockchain{LastHash: "lastHash"}, 1, 1)
@@ -51,3 +62,52 @@ func TestCreateBlock(t *testing.T) {
 		t.Errorf("Expected transaction count: 2, Got: %d", len(tb.Transactions))
 	}
 }
+
+func TestMine(t *testing.T) {
+	t.Run("should find a hash meeting the difficulty", func(t *testing.T) {
+		b := &Block{Difficulty: 1}
+		if !b.Mine(nil) || b.Hash[0] != '0' {
+			t.Errorf("Expected a hash starting with 0, Got: %s", b.Hash)
+		}
+	})
+	t.Run("should give up when stopped", func(t *testing.T) {
+		stop := make(chan struct{})
+		close(stop)
+		b := &Block{Difficulty: 64}
+		if b.Mine(stop) {
+			t.Error("should not find a block")
+		}
+	})
+}
+
+func TestAddMinedBlock(t *testing.T) {
+	t.Run("should reject a block on an old tip", func(t *testing.T) {
+		b := &Block{PrevHash: "oldTip", Difficulty: 1}
+		b.Mine(nil)
+		err := (&blockchain{LastHash: "newTip"}).AddMinedBlock(b)
+		if err != errStaleBlock {
+			t.Errorf("Expected: %v, Got: %v", errStaleBlock, err)
+		}
+	})
+	t.Run("should validate the transactions", func(t *testing.T) {
+		defer withParams(&chainParams{ChainId: "test", Checkpoints: map[int]string{}})()
+		defer func() { storage = testStorage{} }()
+		_, chain := storeTestChain()
+		paid := chain[1].Transactions[0]
+		txIn := func() *TxIn {
+			return &TxIn{TxId: paid.Id, Index: 0, SigHash: SigHashAll, Signature: "signature"}
+		}
+		spendTwice := &Tx{
+			Timestamp: 1,
+			TxIns:     []*TxIn{txIn(), txIn()},
+			TxOuts:    []*TxOut{{Address: toAddress, Amount: 2 * paid.TxOuts[0].Amount}},
+		}
+		spendTwice.calcId()
+		spendTwice.calcWitnessHash()
+		block := mineTestBlock(chain[1], 0, spendTwice)
+		err := (&blockchain{LastHash: chain[1].Hash}).AddMinedBlock(block)
+		if err != errDoubleSpend {
+			t.Errorf("Expected: %v, Got: %v", errDoubleSpend, err)
+		}
+	})
+}
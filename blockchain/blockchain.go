@@ -1,6 +1,7 @@
 package blockchain
 
 import (
+	"errors"
 	"sync"
 
 	"github.com/fantasticake/simple-coin/db"
@@ -8,16 +9,32 @@ import (
 )
 
 type blockchain struct {
-	LastHash string
-	m        sync.Mutex
+	LastHash     string
+	PrunedHeight int
+	// SnapshotHeight is the height of a loaded UTXO snapshot whose history
+	// is not validated yet.
+	SnapshotHeight int
+	m              sync.Mutex
+	// connecting is held while a block is validated and connected, so the
+	// tip can't move in between.
+	connecting sync.Mutex
 }
 
 type storageLayer interface {
 	GetBlockchain() []byte
 	SaveBlockchain(data []byte)
 	ClearBlocks()
+	ClearIndexes()
 	FindBlock(key []byte) ([]byte, error)
-	SaveBlock(key []byte, data []byte)
+	FindHeader(key []byte) ([]byte, error)
+	FindUTxOut(key []byte) ([]byte, error)
+	FindUndo(key []byte) ([]byte, error)
+	ForEachUTxOut(fn func(key []byte, data []byte))
+	ForEachBlock(fn func(key []byte, data []byte))
+	ConnectBlock(key []byte, block []byte, header []byte, undo []byte, spent [][]byte, created map[string][]byte)
+	LoadSnapshot(headers map[string][]byte, key []byte, block []byte, utxos map[string][]byte)
+	DeleteBlock(key []byte) int
+	BlocksSize() int
 }
 
 type dbStorage struct{}
@@ -31,11 +48,38 @@ func (dbStorage) SaveBlockchain(data []byte) {
 func (dbStorage) ClearBlocks() {
 	db.ClearBlocks()
 }
+func (dbStorage) ClearIndexes() {
+	db.ClearIndexes()
+}
 func (dbStorage) FindBlock(key []byte) ([]byte, error) {
 	return db.FindBlock(key)
 }
-func (dbStorage) SaveBlock(key []byte, data []byte) {
-	db.SaveBlock(key, data)
+func (dbStorage) FindHeader(key []byte) ([]byte, error) {
+	return db.FindHeader(key)
+}
+func (dbStorage) FindUTxOut(key []byte) ([]byte, error) {
+	return db.FindUTxOut(key)
+}
+func (dbStorage) FindUndo(key []byte) ([]byte, error) {
+	return db.FindUndo(key)
+}
+func (dbStorage) ForEachUTxOut(fn func(key []byte, data []byte)) {
+	db.ForEachUTxOut(fn)
+}
+func (dbStorage) ForEachBlock(fn func(key []byte, data []byte)) {
+	db.ForEachBlock(fn)
+}
+func (dbStorage) ConnectBlock(key []byte, block []byte, header []byte, undo []byte, spent [][]byte, created map[string][]byte) {
+	db.ConnectBlock(key, block, header, undo, spent, created)
+}
+func (dbStorage) LoadSnapshot(headers map[string][]byte, key []byte, block []byte, utxos map[string][]byte) {
+	db.LoadSnapshot(headers, key, block, utxos)
+}
+func (dbStorage) DeleteBlock(key []byte) int {
+	return db.DeleteBlock(key)
+}
+func (dbStorage) BlocksSize() int {
+	return db.BlocksSize()
 }
 
 var (
@@ -44,6 +88,8 @@ var (
 	blocksPerMin         int = 2
 	blocksPerMinErrRange int = 1
 
+	errStaleBlock = errors.New("Block does not extend the current tip")
+
 	b       *blockchain
 	storage storageLayer = dbStorage{}
 	w       walletLayer  = ecWallet{}
@@ -57,7 +103,7 @@ func BC() *blockchain {
 		if blockchainAsB != nil {
 			utils.FromBytes(b, blockchainAsB)
 		} else {
-			b.AddBlock()
+			b.connectBlock(genesisBlock(params))
 		}
 	})
 	return b
@@ -88,21 +134,82 @@ func (b *blockchain) updateBlockchain(block *Block) {
 	defer b.m.Unlock()
 	b.LastHash = block.Hash
 	PersistBlockchain(b)
+	notifyChange()
 }
 
 func (b *blockchain) AddBlock() *Block {
+	b.connecting.Lock()
+	defer b.connecting.Unlock()
 	block := createBlock(b, GetHeight(b), getDifficulty(b))
-	persistBlock(block)
-	b.updateBlockchain(block)
+	b.connectBlock(block)
 	return block
 }
 
-func (b *blockchain) AddPeerBlock(block *Block) {
+// TipHash returns the hash of the last block, read under the chain lock.
+func TipHash(b *blockchain) string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.LastHash
+}
+
+// AddMinedBlock adds a block mined from a template, unless the tip moved
+// while it was being mined. It is validated like a peer's block, since
+// peers will reject it otherwise.
+func (b *blockchain) AddMinedBlock(block *Block) error {
+	b.connecting.Lock()
+	defer b.connecting.Unlock()
+	if block.PrevHash != TipHash(b) || !block.verifyCommitments() {
+		return errStaleBlock
+	}
+	err := b.validateOnTip(block, true)
+	if err != nil {
+		return err
+	}
+	b.connectBlock(block)
+	return nil
+}
+
+func (b *blockchain) connectBlock(block *Block) {
 	persistBlock(block)
+	markWalletOutputs(block)
 	b.updateBlockchain(block)
 	for _, tx := range block.Transactions {
 		Mempool().removeTx(tx.Id)
 	}
+	b.prune()
+}
+
+// AddPeerBlock validates a block announced by a peer on top of the tip and
+// adds it.
+func (b *blockchain) AddPeerBlock(block *Block) error {
+	// A peer announces a single block, so of its history only the block
+	// itself is known to be covered by the assume-valid block.
+	return b.addPeerBlock(block, assumeValidHeight([]*Block{block}))
+}
+
+// addPeerBlock adds a block of a peer, skipping signatures when it is at
+// or below skipSigsUpTo.
+func (b *blockchain) addPeerBlock(block *Block, skipSigsUpTo int) error {
+	b.connecting.Lock()
+	defer b.connecting.Unlock()
+	err := b.validateOnTip(block, block.Height > skipSigsUpTo)
+	if err != nil {
+		return err
+	}
+	b.connectBlock(block)
+	return nil
+}
+
+// validateOnTip checks block on top of the current tip against the UTXO
+// set. The caller holds b.connecting.
+func (b *blockchain) validateOnTip(block *Block, checkSigs bool) error {
+	if block.Difficulty != getDifficulty(b) {
+		return errBadDifficulty
+	}
+	lookup := func(txIn *TxIn) *TxOut {
+		return findTxOut(b, txIn)
+	}
+	return validateBlock(block, LastBlock(b), lookup, checkSigs)
 }
 
 func Blocks(b *blockchain) []*Block {
@@ -115,7 +222,10 @@ func Blocks(b *blockchain) []*Block {
 			break
 		}
 		block, err := FindBlock(hashCursor)
-		utils.HandleErr(err)
+		if err != nil {
+			// Older blocks were pruned.
+			break
+		}
 		blocks = append(blocks, block)
 		hashCursor = block.PrevHash
 	}
@@ -135,7 +245,26 @@ func LastBlock(b *blockchain) *Block {
 
 func recalcDifficulty(b *blockchain) int {
 	lastBlock := LastBlock(b)
-	startBlock := Blocks(b)[recalcDiffInterval-1]
+	startBlock := ancestor(b, recalcDiffInterval-1)
+	return adjustDifficulty(lastBlock, startBlock)
+}
+
+// ancestor returns the header of the block depth blocks below the tip.
+func ancestor(b *blockchain, depth int) *Block {
+	b.m.Lock()
+	defer b.m.Unlock()
+	header, err := findHeader(b.LastHash)
+	utils.HandleErr(err)
+	for i := 0; i < depth; i++ {
+		header, err = findHeader(header.PrevHash)
+		utils.HandleErr(err)
+	}
+	return header
+}
+
+// adjustDifficulty compares how long the blocks from startBlock to lastBlock
+// took with the expected pace.
+func adjustDifficulty(lastBlock *Block, startBlock *Block) int {
 	actualTime := (lastBlock.Timestamp - startBlock.Timestamp) / 60
 	aTimePerBlock := actualTime / (recalcDiffInterval - 1)
 	if aTimePerBlock < blocksPerMin-blocksPerMinErrRange {
@@ -156,13 +285,32 @@ func getDifficulty(b *blockchain) int {
 	}
 }
 
-func (b *blockchain) ReplaceBlocks(blocks []*Block) {
-	if len(blocks) > 0 {
-		b.updateBlockchain(blocks[0])
+// ReplaceBlocks swaps the chain for blocks, ordered from the tip down,
+// after validating them from genesis up.
+func (b *blockchain) ReplaceBlocks(blocks []*Block) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	chain := make([]*Block, len(blocks))
+	for i, block := range blocks {
+		chain[len(blocks)-1-i] = block
+	}
+	err := validateChain(chain)
+	if err != nil {
+		return err
+	}
 
-		storage.ClearBlocks()
-		for _, block := range blocks {
-			persistBlock(block)
-		}
+	b.connecting.Lock()
+	defer b.connecting.Unlock()
+	storage.ClearBlocks()
+	for _, block := range chain {
+		persistBlock(block)
+		markWalletOutputs(block)
 	}
+	b.m.Lock()
+	b.PrunedHeight = 0
+	b.m.Unlock()
+	b.updateBlockchain(blocks[0])
+	b.prune()
+	return nil
 }
@@ -1,6 +1,7 @@
 package blockchain
 
 import (
+	"errors"
 	"sync"
 	"testing"
 
@@ -10,6 +11,7 @@ import (
 type testStorage struct {
 	fakeGetBlockchain func() []byte
 	fakeFindBlock     func(key []byte) ([]byte, error)
+	fakeFindUTxOut    func(key []byte) ([]byte, error)
 }
 
 func (t testStorage) GetBlockchain() []byte {
@@ -20,7 +22,27 @@ func (testStorage) ClearBlocks()               {}
 func (t testStorage) FindBlock(key []byte) ([]byte, error) {
 	return t.fakeFindBlock(key)
 }
-func (testStorage) SaveBlock(key []byte, data []byte) {}
+func (t testStorage) FindHeader(key []byte) ([]byte, error) {
+	return t.fakeFindBlock(key)
+}
+func (t testStorage) FindUTxOut(key []byte) ([]byte, error) {
+	if t.fakeFindUTxOut == nil {
+		return nil, errors.New("Not found")
+	}
+	return t.fakeFindUTxOut(key)
+}
+func (testStorage) FindUndo(key []byte) ([]byte, error) {
+	return nil, errors.New("Not found")
+}
+func (testStorage) ClearIndexes()                                  {}
+func (testStorage) ForEachUTxOut(fn func(key []byte, data []byte)) {}
+func (testStorage) ForEachBlock(fn func(key []byte, data []byte))  {}
+func (testStorage) ConnectBlock(key []byte, block []byte, header []byte, undo []byte, spent [][]byte, created map[string][]byte) {
+}
+func (testStorage) LoadSnapshot(headers map[string][]byte, key []byte, block []byte, utxos map[string][]byte) {
+}
+func (testStorage) DeleteBlock(key []byte) int { return 0 }
+func (testStorage) BlocksSize() int            { return 0 }
 
 func TestBC(t *testing.T) {
 	t.Run("should return a new blockchain with a block", func(t *testing.T) {
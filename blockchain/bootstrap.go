@@ -0,0 +1,144 @@
+package blockchain
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/fantasticake/simple-coin/utils"
+)
+
+// A bootstrap file holds the blocks from genesis up, each one as JSON
+// prefixed by its length as a big-endian uint32.
+const maxBootstrapRecord = 32 << 20
+
+var errBadRecord = errors.New("Bootstrap record is too large")
+
+// ExportChain writes the stored chain to w and returns how many blocks it
+// wrote.
+func ExportChain(w io.Writer) (int, error) {
+	stored, err := storedChain()
+	if err != nil {
+		return 0, err
+	}
+	if stored.PrunedHeight > 0 {
+		return 0, errPrunedChain
+	}
+	headers, err := storedHeaders(stored.LastHash)
+	if err != nil {
+		return 0, err
+	}
+	for _, header := range headers {
+		block, err := FindBlock(header.Hash)
+		if err != nil {
+			return 0, fmt.Errorf("Block %d: %w", header.Height, err)
+		}
+		if err := writeRecord(w, utils.ToJson(block)); err != nil {
+			return 0, err
+		}
+	}
+	return len(headers), nil
+}
+
+// ImportChain connects the blocks read from r on top of the stored chain,
+// validating each one, and returns how many blocks it added. Blocks we
+// already have are skipped. The file is read twice, first for its headers
+// to find out which blocks the assume-valid block covers.
+func ImportChain(r io.ReadSeeker) (int, error) {
+	skipSigsUpTo, err := scanAssumeValid(bufio.NewReader(r))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(r)
+	target, err := storedChain()
+	if err != nil {
+		target = &blockchain{}
+	}
+	imported := 0
+	for {
+		block, err := readBlock(reader)
+		if err == io.EOF {
+			return imported, nil
+		} else if err != nil {
+			return imported, err
+		}
+		if _, err := storage.FindHeader([]byte(block.Hash)); err == nil {
+			continue
+		}
+		if err := target.addPeerBlock(block, skipSigsUpTo); err != nil {
+			return imported, fmt.Errorf("Block %d: %w", block.Height, err)
+		}
+		imported++
+	}
+}
+
+// scanAssumeValid returns the height of the assume-valid block in a
+// bootstrap file, or 0 when the file doesn't hold it. Only headers with
+// valid proof of work linked to the ones before count, so the blocks below
+// it really are its ancestors.
+func scanAssumeValid(r io.Reader) (int, error) {
+	var prev *Block
+	for {
+		block, err := readBlock(r)
+		if err == io.EOF {
+			return 0, nil
+		} else if err != nil {
+			return 0, err
+		}
+		header := block.withoutTxs()
+		if header.Hash != header.calcHash() || !header.meetsDifficulty() {
+			return 0, nil
+		}
+		if prev != nil && (header.PrevHash != prev.Hash || header.Height != prev.Height+1) {
+			return 0, nil
+		}
+		if height := assumeValidHeight([]*Block{header}); height > 0 {
+			return height, nil
+		}
+		prev = header
+	}
+}
+
+func readBlock(r io.Reader) (*Block, error) {
+	record, err := readRecord(r)
+	if err != nil {
+		return nil, err
+	}
+	block := &Block{}
+	if err := json.Unmarshal(record, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func writeRecord(w io.Writer, data []byte) error {
+	err := binary.Write(w, binary.BigEndian, uint32(len(data)))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func readRecord(r io.Reader) ([]byte, error) {
+	var size uint32
+	err := binary.Read(r, binary.BigEndian, &size)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxBootstrapRecord {
+		return nil, errBadRecord
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return data, err
+}
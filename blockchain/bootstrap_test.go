@@ -0,0 +1,75 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/fantasticake/simple-coin/utils"
+)
+
+func TestExportImportChain(t *testing.T) {
+	defer withParams(&chainParams{ChainId: "test", Checkpoints: map[int]string{}})()
+	defer func() { storage = testStorage{} }()
+
+	_, chain := storeTestChain()
+	var file bytes.Buffer
+	exported, err := ExportChain(&file)
+	if err != nil || exported != 2 {
+		t.Fatalf("Expected: 2 blocks exported, Got: %d %v", exported, err)
+	}
+	data := file.Bytes()
+
+	t.Run("should import into a fresh node", func(t *testing.T) {
+		storage = newMemStorage()
+		imported, err := ImportChain(bytes.NewReader(data))
+		if err != nil || imported != 2 {
+			t.Fatalf("Expected: 2 blocks imported, Got: %d %v", imported, err)
+		}
+		if stored, _ := storedChain(); stored.LastHash != chain[1].Hash {
+			t.Errorf("Expected tip: %s, Got: %s", chain[1].Hash, stored.LastHash)
+		}
+		if _, err := VerifyChain(CheckUTXO, 0); err != nil {
+			t.Errorf("Expected: nil, Got: %v", err)
+		}
+	})
+	t.Run("should skip blocks it already has", func(t *testing.T) {
+		imported, err := ImportChain(bytes.NewReader(data))
+		if err != nil || imported != 0 {
+			t.Errorf("Expected: 0 blocks imported, Got: %d %v", imported, err)
+		}
+	})
+	t.Run("should reject an invalid block", func(t *testing.T) {
+		storage = newMemStorage()
+		w = rejectingWallet{}
+		defer func() { w = testWallet{} }()
+		imported, err := ImportChain(bytes.NewReader(data))
+		if imported != 1 || !errors.Is(err, errBadTx) {
+			t.Errorf("Expected: 1 block then %v, Got: %d %v", errBadTx, imported, err)
+		}
+	})
+	t.Run("should skip signatures of the assume-valid block's ancestors", func(t *testing.T) {
+		storage = newMemStorage()
+		w = rejectingWallet{}
+		defer func() { w = testWallet{} }()
+		third := mineTestBlock(chain[1], 0)
+		var file bytes.Buffer
+		for _, block := range append(chain, third) {
+			writeRecord(&file, utils.ToJson(block))
+		}
+		params.AssumeValid = third.Hash
+		defer func() { params.AssumeValid = "" }()
+		imported, err := ImportChain(bytes.NewReader(file.Bytes()))
+		if err != nil || imported != 3 {
+			t.Errorf("Expected: 3 blocks imported, Got: %d %v", imported, err)
+		}
+	})
+	t.Run("should report a truncated file", func(t *testing.T) {
+		storage = newMemStorage()
+		_, err := ImportChain(bytes.NewReader(data[:len(data)-1]))
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("Expected: %v, Got: %v", io.ErrUnexpectedEOF, err)
+		}
+	})
+}
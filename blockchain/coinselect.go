@@ -0,0 +1,154 @@
+package blockchain
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+)
+
+var (
+	feePerInput  int = 1
+	feePerOutput int = 1
+	// costOfChange is what a change output costs now and when it's spent later.
+	costOfChange int = feePerOutput + feePerInput
+	bnbMaxTries  int = 100000
+
+	errUnknownStrategy = errors.New("Unknown coin selection strategy")
+)
+
+// coinSelector picks coins whose value after their input fee covers target.
+// It returns nil when the coins are not enough.
+type coinSelector interface {
+	selectCoins(coins []*UTxOut, target int) []*UTxOut
+}
+
+var coinSelectors = map[string]coinSelector{
+	"bnb":      branchAndBound{},
+	"largest":  largestFirst{},
+	"smallest": smallestFirst{},
+	"privacy":  privacyFirst{},
+}
+
+const defaultStrategy = "bnb"
+
+func getCoinSelector(strategy string) (coinSelector, error) {
+	if strategy == "" {
+		strategy = defaultStrategy
+	}
+	selector, ok := coinSelectors[strategy]
+	if !ok {
+		return nil, errUnknownStrategy
+	}
+	return selector, nil
+}
+
+func txFee(inputs int, outputs int) int {
+	return inputs*feePerInput + outputs*feePerOutput
+}
+
+func effectiveValue(coin *UTxOut) int {
+	return coin.Amount - feePerInput
+}
+
+// spendableCoins drops coins that cost more to spend than they are worth.
+func spendableCoins(coins []*UTxOut) []*UTxOut {
+	var spendable []*UTxOut
+	for _, coin := range coins {
+		if effectiveValue(coin) > 0 {
+			spendable = append(spendable, coin)
+		}
+	}
+	return spendable
+}
+
+// accumulate takes coins in order until they cover target.
+func accumulate(coins []*UTxOut, target int) []*UTxOut {
+	var selected []*UTxOut
+	var total int
+	for _, coin := range coins {
+		if total >= target {
+			break
+		}
+		selected = append(selected, coin)
+		total += effectiveValue(coin)
+	}
+	if total < target {
+		return nil
+	}
+	return selected
+}
+
+type largestFirst struct{}
+
+func (largestFirst) selectCoins(coins []*UTxOut, target int) []*UTxOut {
+	coins = spendableCoins(coins)
+	sort.SliceStable(coins, func(i, j int) bool { return coins[i].Amount > coins[j].Amount })
+	return accumulate(coins, target)
+}
+
+type smallestFirst struct{}
+
+func (smallestFirst) selectCoins(coins []*UTxOut, target int) []*UTxOut {
+	coins = spendableCoins(coins)
+	sort.SliceStable(coins, func(i, j int) bool { return coins[i].Amount < coins[j].Amount })
+	return accumulate(coins, target)
+}
+
+// privacyFirst avoids linking coins together: it spends the smallest single
+// coin that covers target and otherwise merges coins in random order.
+type privacyFirst struct{}
+
+func (privacyFirst) selectCoins(coins []*UTxOut, target int) []*UTxOut {
+	coins = spendableCoins(coins)
+	var best *UTxOut
+	for _, coin := range coins {
+		if effectiveValue(coin) >= target && (best == nil || coin.Amount < best.Amount) {
+			best = coin
+		}
+	}
+	if best != nil {
+		return []*UTxOut{best}
+	}
+	rand.Shuffle(len(coins), func(i, j int) { coins[i], coins[j] = coins[j], coins[i] })
+	return accumulate(coins, target)
+}
+
+// branchAndBound searches for coins that cover target without leaving
+// enough to pay for a change output, and falls back to largest first.
+type branchAndBound struct{}
+
+func (branchAndBound) selectCoins(coins []*UTxOut, target int) []*UTxOut {
+	coins = spendableCoins(coins)
+	sort.SliceStable(coins, func(i, j int) bool { return coins[i].Amount > coins[j].Amount })
+
+	remaining := make([]int, len(coins)+1)
+	for i := len(coins) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + effectiveValue(coins[i])
+	}
+
+	var selected []*UTxOut
+	tries := 0
+	var search func(index int, total int) bool
+	search = func(index int, total int) bool {
+		tries++
+		if total > target+costOfChange || tries > bnbMaxTries {
+			return false
+		}
+		if total >= target {
+			return true
+		}
+		if index == len(coins) || total+remaining[index] < target {
+			return false
+		}
+		selected = append(selected, coins[index])
+		if search(index+1, total+effectiveValue(coins[index])) {
+			return true
+		}
+		selected = selected[:len(selected)-1]
+		return search(index+1, total)
+	}
+	if search(0, 0) {
+		return selected
+	}
+	return largestFirst{}.selectCoins(coins, target)
+}
@@ -0,0 +1,74 @@
+package blockchain
+
+import "testing"
+
+func coinsOf(amounts ...int) []*UTxOut {
+	var coins []*UTxOut
+	for index, amount := range amounts {
+		coins = append(coins, &UTxOut{TxId: "txId", Index: index, Amount: amount})
+	}
+	return coins
+}
+
+func sumOf(coins []*UTxOut) int {
+	var total int
+	for _, coin := range coins {
+		total += coin.Amount
+	}
+	return total
+}
+
+func TestGetCoinSelector(t *testing.T) {
+	if _, err := getCoinSelector(""); err != nil {
+		t.Error("should return a default strategy")
+	}
+	if _, err := getCoinSelector("unknown"); err != errUnknownStrategy {
+		t.Errorf("Expected: %v, Got: %v", errUnknownStrategy, err)
+	}
+}
+
+func TestSelectCoins(t *testing.T) {
+	t.Run("largest first should take the largest coins", func(t *testing.T) {
+		coins := largestFirst{}.selectCoins(coinsOf(3, 10, 5), 12)
+		if len(coins) != 2 || sumOf(coins) != 15 {
+			t.Errorf("Expected: 10+5, Got: %d coins worth %d", len(coins), sumOf(coins))
+		}
+	})
+	t.Run("smallest first should take the smallest coins", func(t *testing.T) {
+		coins := smallestFirst{}.selectCoins(coinsOf(3, 10, 5), 6)
+		if len(coins) != 2 || sumOf(coins) != 8 {
+			t.Errorf("Expected: 3+5, Got: %d coins worth %d", len(coins), sumOf(coins))
+		}
+	})
+	t.Run("should account for the fee of each input", func(t *testing.T) {
+		coins := largestFirst{}.selectCoins(coinsOf(5, 5), 10)
+		if coins != nil {
+			t.Error("two coins of 5 can't pay 10 and two input fees")
+		}
+	})
+	t.Run("should skip coins worth less than their fee", func(t *testing.T) {
+		coins := smallestFirst{}.selectCoins(coinsOf(1, 1, 1), 1)
+		if coins != nil {
+			t.Error("dust should not be selected")
+		}
+	})
+	t.Run("privacy should spend a single covering coin", func(t *testing.T) {
+		coins := privacyFirst{}.selectCoins(coinsOf(3, 10, 7, 20), 5)
+		if len(coins) != 1 || coins[0].Amount != 7 {
+			t.Errorf("Expected: 7, Got: %d coins worth %d", len(coins), sumOf(coins))
+		}
+	})
+	t.Run("branch and bound should find a changeless solution", func(t *testing.T) {
+		coins := branchAndBound{}.selectCoins(coinsOf(11, 7, 4, 6), 9)
+		excess := sumOf(coins) - len(coins)*feePerInput - 9
+		if excess < 0 || excess > costOfChange {
+			t.Errorf("Expected a changeless selection, Got: %d coins worth %d", len(coins), sumOf(coins))
+		}
+	})
+	t.Run("branch and bound should fall back when no exact match exists", func(t *testing.T) {
+		coins := branchAndBound{}.selectCoins(coinsOf(50), 9)
+		if len(coins) != 1 {
+			t.Errorf("Expected: 1 coin, Got: %d", len(coins))
+		}
+	})
+}
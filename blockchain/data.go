@@ -0,0 +1,56 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"unicode/utf8"
+
+	"github.com/fantasticake/simple-coin/wallet"
+)
+
+// maxDataSize bounds the payload of a data output in bytes.
+var maxDataSize int = 80
+
+// isData reports whether the output carries data. Data outputs have no
+// address or amount, so they never become spendable.
+func (o *TxOut) isData() bool {
+	return o.Data != ""
+}
+
+func validateData(o *TxOut) error {
+	data, err := hex.DecodeString(o.Data)
+	if err != nil {
+		return errors.New("Data should be hex encoded")
+	}
+	if len(data) > maxDataSize {
+		return errors.New("Data is too large")
+	}
+	if o.Address != "" || o.Amount != 0 || o.HTLC != nil {
+		return errors.New("Data outputs can't carry coins")
+	}
+	return nil
+}
+
+func (m *mempool) AddData(b *blockchain, wl *wallet.W, data []byte, strategy string) (*Tx, error) {
+	return m.AddTx(b, wl, []*TxOut{{Data: hex.EncodeToString(data)}}, strategy)
+}
+
+// Data returns the payloads anchored in the block, as text when they are
+// valid UTF-8 and as hex otherwise.
+func (b *Block) Data() []string {
+	var payloads []string
+	for _, tx := range b.Transactions {
+		for _, txOut := range tx.TxOuts {
+			if !txOut.isData() {
+				continue
+			}
+			data, err := hex.DecodeString(txOut.Data)
+			if err == nil && utf8.Valid(data) {
+				payloads = append(payloads, string(data))
+			} else {
+				payloads = append(payloads, txOut.Data)
+			}
+		}
+	}
+	return payloads
+}
@@ -0,0 +1,44 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestValidateData(t *testing.T) {
+	t.Run("should accept a bounded payload", func(t *testing.T) {
+		if err := validateData(&TxOut{Data: "68656c6c6f"}); err != nil {
+			t.Errorf("Expected: nil, Got: %v", err)
+		}
+	})
+	t.Run("should reject a payload over maxDataSize", func(t *testing.T) {
+		data := hex.EncodeToString([]byte(strings.Repeat("a", maxDataSize+1)))
+		if err := validateData(&TxOut{Data: data}); err == nil {
+			t.Error("should return an error")
+		}
+	})
+	t.Run("should reject coins on a data output", func(t *testing.T) {
+		if err := validateData(&TxOut{Data: "00", Amount: 1}); err == nil {
+			t.Error("should return an error")
+		}
+	})
+}
+
+func TestDataOutputSpender(t *testing.T) {
+	if _, ok := (&TxOut{Data: "00"}).spender(&TxIn{}, 1); ok {
+		t.Error("data outputs should be unspendable")
+	}
+}
+
+func TestBlockData(t *testing.T) {
+	block := &Block{Transactions: []*Tx{{TxOuts: []*TxOut{
+		{Address: "a", Amount: 1},
+		{Data: "68656c6c6f"},
+		{Data: "ff"},
+	}}}}
+	data := block.Data()
+	if len(data) != 2 || data[0] != "hello" || data[1] != "ff" {
+		t.Errorf("Expected: [hello ff], Got: %v", data)
+	}
+}
@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"sort"
+
+	"github.com/fantasticake/simple-coin/utils"
+	"github.com/fantasticake/simple-coin/wallet"
+)
+
+// WalletTx is a transaction touching a wallet: what it paid the wallet and
+// what it spent of the wallet's coins. WatchOnly is set when it only
+// touches addresses the wallet watches without keys.
+type WalletTx struct {
+	TxId      string `json:"txId"`
+	Height    int    `json:"height"` // 0 while on the mempool
+	Timestamp int    `json:"timestamp"`
+	Received  int    `json:"received"`
+	Sent      int    `json:"sent"`
+	WatchOnly bool   `json:"watchOnly,omitempty"`
+}
+
+// GetWalletHistory lists the transactions paying or spending the addresses
+// wl watches, the newest first. Blocks whose bodies were pruned are skipped.
+func GetWalletHistory(wl *wallet.W) ([]*WalletTx, error) {
+	stored, err := storedChain()
+	if err != nil {
+		return nil, err
+	}
+	headers, err := storedHeaders(stored.LastHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []*WalletTx
+	for _, header := range headers {
+		block, err := FindBlock(header.Hash)
+		if err != nil {
+			continue
+		}
+		undoAsB, err := storage.FindUndo([]byte(block.Hash))
+		if err != nil {
+			continue
+		}
+		var undo []spentOutput
+		utils.FromBytes(&undo, undoAsB)
+		spent := make(map[string]*TxOut)
+		for _, output := range undo {
+			spent[output.Outpoint] = output.TxOut
+		}
+		lookup := func(txIn *TxIn) *TxOut {
+			return spent[outpoint(txIn.TxId, txIn.Index)]
+		}
+		for _, tx := range block.Transactions {
+			if entry := walletTx(wl, tx, block.Height, lookup); entry != nil {
+				history = append(history, entry)
+			}
+		}
+	}
+
+	var pending []*WalletTx
+	for _, tx := range MemPoolTxs(Mempool()) {
+		lookup := func(txIn *TxIn) *TxOut { return findUTxOut(txIn.TxId, txIn.Index) }
+		if entry := walletTx(wl, tx, 0, lookup); entry != nil {
+			pending = append(pending, entry)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Timestamp < pending[j].Timestamp })
+	history = append(history, pending...)
+
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	return history, nil
+}
+
+// walletTx sums what tx pays and spends of the addresses wl watches, or
+// returns nil when it touches none of them.
+func walletTx(wl *wallet.W, tx *Tx, height int, lookup func(txIn *TxIn) *TxOut) *WalletTx {
+	entry := &WalletTx{TxId: tx.Id, Height: height, Timestamp: tx.Timestamp}
+	touched, owned := false, false
+	touch := func(address string) bool {
+		if !w.Watches(wl, address) {
+			return false
+		}
+		touched = true
+		owned = owned || w.Owns(wl, address)
+		return true
+	}
+	if !isCoinbase(tx) {
+		for _, txIn := range tx.TxIns {
+			if txOut := lookup(txIn); txOut != nil && touch(txOut.Address) {
+				entry.Sent += txOut.Amount
+			}
+		}
+	}
+	for _, txOut := range tx.TxOuts {
+		if !txOut.isData() && touch(txOut.Address) {
+			entry.Received += txOut.Amount
+		}
+	}
+	if !touched {
+		return nil
+	}
+	entry.WatchOnly = !owned
+	return entry
+}
@@ -0,0 +1,67 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/fantasticake/simple-coin/wallet"
+)
+
+func TestGetWalletHistory(t *testing.T) {
+	defer withParams(&chainParams{ChainId: "test", Checkpoints: map[int]string{}})()
+	defer func() { storage = testStorage{} }()
+	defer SetMiningAddress("")
+
+	SetMiningAddress("miner")
+	_, chain := storeTestChain()
+	w = coldWallet{}
+	defer func() { w = testWallet{} }()
+
+	history, err := GetWalletHistory(w.Wallet())
+	if err != nil || len(history) != 3 {
+		t.Fatalf("Expected: 3 transactions, Got: %v %v", history, err)
+	}
+	if history[0].Height != 2 || history[0].Received != minerReward+1 {
+		t.Errorf("Expected the newest coinbase first, Got: %+v", history[0])
+	}
+	spend := history[1]
+	if spend.TxId != chain[1].Transactions[0].Id || spend.Sent != minerReward || spend.Received != minerReward-1 {
+		t.Errorf("Expected a spend of %d to the watched address, Got: %+v", minerReward, spend)
+	}
+	if spend.WatchOnly {
+		t.Error("should not flag a spend of owned coins as watch-only")
+	}
+	if history[2].Height != 1 || history[2].Received != minerReward {
+		t.Errorf("Expected the genesis coinbase last, Got: %+v", history[2])
+	}
+}
+
+func TestWatchOnlyHistory(t *testing.T) {
+	defer withParams(&chainParams{ChainId: "test", Checkpoints: map[int]string{}})()
+	defer func() { storage = testStorage{} }()
+	defer SetMiningAddress("")
+
+	SetMiningAddress("miner")
+	storeTestChain()
+	w = watchingWallet{}
+	defer func() { w = testWallet{} }()
+
+	history, err := GetWalletHistory(w.Wallet())
+	if err != nil || len(history) != 1 {
+		t.Fatalf("Expected: 1 transaction, Got: %v %v", history, err)
+	}
+	if !history[0].WatchOnly || history[0].Received != minerReward-1 {
+		t.Errorf("Expected a watch-only payment of %d, Got: %+v", minerReward-1, history[0])
+	}
+}
+
+// watchingWallet only watches the coins of toAddress.
+type watchingWallet struct {
+	testWallet
+}
+
+func (watchingWallet) Owns(w *wallet.W, address string) bool {
+	return false
+}
+func (watchingWallet) Watches(w *wallet.W, address string) bool {
+	return address == toAddress
+}
@@ -0,0 +1,176 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/fantasticake/simple-coin/wallet"
+)
+
+// HTLC locks an output to a SHA-256 hash and a deadline. Before Locktime
+// the recipient can spend it by revealing the preimage, from Locktime on
+// the refund address can take it back.
+type HTLC struct {
+	Hash      string `json:"hash"`
+	Recipient string `json:"recipient"`
+	Refund    string `json:"refund"`
+	Locktime  int    `json:"locktime"`
+}
+
+var (
+	errHTLCNotFound = errors.New("HTLC not found or already spent")
+	errHTLCSpent    = errors.New("HTLC is being spent on mempool")
+	errWrongOwner   = errors.New("HTLC does not belong to this wallet")
+	errBadPreimage  = errors.New("Preimage does not match hash")
+	errHTLCExpired  = errors.New("HTLC locktime has passed")
+	errHTLCLocked   = errors.New("HTLC locktime has not passed yet")
+	errNoPreimage   = errors.New("Preimage not found")
+	errPrunedClaim  = errors.New("Preimage not found in the stored blocks, the claim may be in pruned history")
+)
+
+func hashPreimage(preimage string) (string, error) {
+	preimageAsB, err := hex.DecodeString(preimage)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(preimageAsB)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func (h *HTLC) spender(preimage string, height int) (string, bool) {
+	if preimage != "" {
+		hash, err := hashPreimage(preimage)
+		if err != nil || hash != h.Hash || height >= h.Locktime {
+			return "", false
+		}
+		return h.Recipient, true
+	}
+	if height < h.Locktime {
+		return "", false
+	}
+	return h.Refund, true
+}
+
+func (m *mempool) AddHTLC(b *blockchain, wl *wallet.W, recipient string, hash string, locktime int, amount int) (*Tx, error) {
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 {
+		return nil, errors.New("Hash should be a hex encoded SHA-256 digest")
+	}
+	if locktime <= GetHeight(b)+1 {
+		return nil, errHTLCExpired
+	}
+	tx, err := makeTx(b, wl, []*TxOut{{
+		Amount: amount,
+		HTLC: &HTLC{
+			Hash:      hash,
+			Recipient: recipient,
+			Refund:    wl.Address,
+			Locktime:  locktime,
+		},
+	}}, "")
+	if err != nil {
+		return nil, err
+	}
+	m.addTx(tx)
+	return tx, nil
+}
+
+func (m *mempool) ClaimHTLC(b *blockchain, wl *wallet.W, txId string, index int, preimage string) (*Tx, error) {
+	htlc, amount, err := findHTLC(b, txId, index)
+	if err != nil {
+		return nil, err
+	}
+	if !w.Owns(wl, htlc.Recipient) {
+		return nil, errWrongOwner
+	}
+	if hash, err := hashPreimage(preimage); err != nil || hash != htlc.Hash {
+		return nil, errBadPreimage
+	}
+	if GetHeight(b)+1 >= htlc.Locktime {
+		return nil, errHTLCExpired
+	}
+	tx, err := makeHTLCSpendTx(b, wl, txId, index, preimage, amount, htlc.Recipient)
+	if err != nil {
+		return nil, err
+	}
+	m.addTx(tx)
+	return tx, nil
+}
+
+func (m *mempool) RefundHTLC(b *blockchain, wl *wallet.W, txId string, index int) (*Tx, error) {
+	htlc, amount, err := findHTLC(b, txId, index)
+	if err != nil {
+		return nil, err
+	}
+	if !w.Owns(wl, htlc.Refund) {
+		return nil, errWrongOwner
+	}
+	if GetHeight(b)+1 < htlc.Locktime {
+		return nil, errHTLCLocked
+	}
+	tx, err := makeHTLCSpendTx(b, wl, txId, index, "", amount, htlc.Refund)
+	if err != nil {
+		return nil, err
+	}
+	m.addTx(tx)
+	return tx, nil
+}
+
+func findHTLC(b *blockchain, txId string, index int) (*HTLC, int, error) {
+	txOut := findUTxOut(txId, index)
+	if txOut == nil || txOut.HTLC == nil {
+		return nil, 0, errHTLCNotFound
+	}
+	if isOnMempool(&UTxOut{TxId: txId, Index: index}) {
+		return nil, 0, errHTLCSpent
+	}
+	return txOut.HTLC, txOut.Amount, nil
+}
+
+func makeHTLCSpendTx(b *blockchain, wl *wallet.W, txId string, index int, preimage string, amount int, owner string) (*Tx, error) {
+	tx := &Tx{
+		Id:        "",
+		Timestamp: int(time.Now().Unix()),
+		TxIns: []*TxIn{{
+			Address:  owner,
+			TxId:     txId,
+			Index:    index,
+			Preimage: preimage,
+		}},
+		TxOuts: []*TxOut{{
+			Address: owner,
+			Amount:  amount,
+		}},
+	}
+	tx.calcId()
+	err := tx.sign(b, wl, SigHashAll)
+	if err != nil {
+		return nil, err
+	}
+	tx.calcWitnessHash()
+	return tx, nil
+}
+
+// FindPreimage looks for a confirmed claim of an HTLC locked to hash and
+// returns the preimage it revealed. Only stored bodies are scanned, so when
+// older blocks are gone the claim may be in them.
+func FindPreimage(b *blockchain, hash string) (string, error) {
+	blocks := Blocks(b)
+	for _, block := range blocks {
+		for _, tx := range block.Transactions {
+			for _, txIn := range tx.TxIns {
+				if txIn.Preimage == "" {
+					continue
+				}
+				if h, err := hashPreimage(txIn.Preimage); err == nil && h == hash {
+					return txIn.Preimage, nil
+				}
+			}
+		}
+	}
+	if len(blocks) > 0 && blocks[len(blocks)-1].Height > 1 {
+		return "", errPrunedClaim
+	}
+	return "", errNoPreimage
+}
@@ -0,0 +1,60 @@
+package blockchain
+
+import "testing"
+
+func TestHTLCSpender(t *testing.T) {
+	// sha256 of 0x01
+	hash := "4bf5122f344554c53bde2ebb8cd2b7e3d1600ad631c385a5d7cce23c7785459a"
+	htlc := &HTLC{Hash: hash, Recipient: "recipient", Refund: "refund", Locktime: 10}
+
+	t.Run("should let the recipient claim with the preimage before locktime", func(t *testing.T) {
+		owner, ok := htlc.spender("01", 9)
+		if !ok || owner != "recipient" {
+			t.Errorf("Expected: recipient, Got: %s", owner)
+		}
+	})
+	t.Run("should reject a wrong preimage", func(t *testing.T) {
+		if _, ok := htlc.spender("02", 9); ok {
+			t.Error("wrong preimage should not unlock the HTLC")
+		}
+	})
+	t.Run("should reject a claim after locktime", func(t *testing.T) {
+		if _, ok := htlc.spender("01", 10); ok {
+			t.Error("preimage should not unlock the HTLC after locktime")
+		}
+	})
+	t.Run("should reject a refund before locktime", func(t *testing.T) {
+		if _, ok := htlc.spender("", 9); ok {
+			t.Error("refund should not be possible before locktime")
+		}
+	})
+	t.Run("should let the sender refund after locktime", func(t *testing.T) {
+		owner, ok := htlc.spender("", 10)
+		if !ok || owner != "refund" {
+			t.Errorf("Expected: refund, Got: %s", owner)
+		}
+	})
+}
+
+func TestFindPreimage(t *testing.T) {
+	defer withParams(&chainParams{ChainId: "test", Checkpoints: map[int]string{}})()
+	defer func() { storage = testStorage{} }()
+	// sha256 of 0x01
+	hash := "4bf5122f344554c53bde2ebb8cd2b7e3d1600ad631c385a5d7cce23c7785459a"
+
+	t.Run("should report a missing claim", func(t *testing.T) {
+		_, chain := storeTestChain()
+		tb := &blockchain{LastHash: chain[1].Hash}
+		if _, err := FindPreimage(tb, hash); err != errNoPreimage {
+			t.Errorf("Expected: %v, Got: %v", errNoPreimage, err)
+		}
+	})
+	t.Run("should warn when older blocks are pruned", func(t *testing.T) {
+		s, chain := storeTestChain()
+		s.DeleteBlock([]byte(chain[0].Hash))
+		tb := &blockchain{LastHash: chain[1].Hash}
+		if _, err := FindPreimage(tb, hash); err != errPrunedClaim {
+			t.Errorf("Expected: %v, Got: %v", errPrunedClaim, err)
+		}
+	})
+}
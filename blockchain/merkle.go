@@ -0,0 +1,33 @@
+package blockchain
+
+import "github.com/fantasticake/simple-coin/utils"
+
+// merkleRoot folds hashes pairwise until one is left, pairing the last
+// hash with itself when a level has an odd count.
+func merkleRoot(hashes []string) string {
+	if len(hashes) == 0 {
+		return ""
+	}
+	level := hashes
+	for len(level) > 1 {
+		var next []string
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			next = append(next, utils.Hash(level[i]+right))
+		}
+		level = next
+	}
+	return level[0]
+}
+
+func txRoots(txs []*Tx) (string, string) {
+	var ids, witnessHashes []string
+	for _, tx := range txs {
+		ids = append(ids, tx.Id)
+		witnessHashes = append(witnessHashes, tx.WitnessHash)
+	}
+	return merkleRoot(ids), merkleRoot(witnessHashes)
+}
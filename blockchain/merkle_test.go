@@ -0,0 +1,26 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/fantasticake/simple-coin/utils"
+)
+
+func TestMerkleRoot(t *testing.T) {
+	t.Run("should return an empty root without hashes", func(t *testing.T) {
+		if root := merkleRoot(nil); root != "" {
+			t.Errorf("Expected: empty root, Got: %s", root)
+		}
+	})
+	t.Run("should return a single hash as the root", func(t *testing.T) {
+		if root := merkleRoot([]string{"a"}); root != "a" {
+			t.Errorf("Expected: a, Got: %s", root)
+		}
+	})
+	t.Run("should pair the last hash with itself", func(t *testing.T) {
+		expected := utils.Hash(utils.Hash("ab") + utils.Hash("cc"))
+		if root := merkleRoot([]string{"a", "b", "c"}); root != expected {
+			t.Errorf("Expected: %s, Got: %s", expected, root)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package blockchain
+
+import "sync"
+
+// subscribers are told when the tip or the mempool changes, so work built
+// on top of them can be thrown away.
+var (
+	subscribers  []chan struct{}
+	subscribersM sync.Mutex
+)
+
+// Subscribe returns a channel told about changes and a func that stops
+// telling it.
+func Subscribe() (<-chan struct{}, func()) {
+	subscribersM.Lock()
+	defer subscribersM.Unlock()
+	ch := make(chan struct{}, 1)
+	subscribers = append(subscribers, ch)
+	return ch, func() { unsubscribe(ch) }
+}
+
+func unsubscribe(ch chan struct{}) {
+	subscribersM.Lock()
+	defer subscribersM.Unlock()
+	for i, subscriber := range subscribers {
+		if subscriber == ch {
+			subscribers = append(subscribers[:i], subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+func notifyChange() {
+	subscribersM.Lock()
+	defer subscribersM.Unlock()
+	for _, ch := range subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package blockchain
+
+import "testing"
+
+func TestSubscribe(t *testing.T) {
+	changes, unsubscribe := Subscribe()
+	notifyChange()
+	select {
+	case <-changes:
+	default:
+		t.Error("should be told about a change")
+	}
+
+	count := len(subscribers)
+	unsubscribe()
+	if len(subscribers) != count-1 {
+		t.Errorf("Expected: %d subscribers, Got: %d", count-1, len(subscribers))
+	}
+	notifyChange()
+	select {
+	case <-changes:
+		t.Error("should not be told after unsubscribing")
+	default:
+	}
+}
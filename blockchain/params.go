@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/fantasticake/simple-coin/wallet"
+)
+
+// chainParams are the consensus settings that differ between networks.
+type chainParams struct {
+	Name    string
+	ChainId string
+	// AddressVersion is the first byte of the network's addresses.
+	AddressVersion byte
+	// The genesis block is fixed, so every node of the network starts from
+	// the same chain. Its reward goes to an address nobody has the key of.
+	GenesisTime    int
+	GenesisAddress string
+	GenesisNonce   int
+	// Checkpoints pin block hashes by height. Chains that disagree with
+	// one of them are rejected. None are pinned until the networks have
+	// history worth pinning.
+	Checkpoints map[int]string
+	// AssumeValid is a block whose ancestors get their signatures skipped
+	// while syncing, since its hash already commits to all of them. It is
+	// empty by default, so every signature is checked unless the operator
+	// sets one.
+	AssumeValid string
+	// AssumeUTXO pins the hashes of UTXO snapshots by block hash. Only
+	// pinned snapshots can be loaded. None are built in, the operator pins
+	// a trusted one with SetAssumeUTXO.
+	AssumeUTXO map[string]string
+}
+
+var (
+	networks = map[string]*chainParams{
+		"main": {
+			Name:           "main",
+			ChainId:        "simple-coin",
+			AddressVersion: 0x3f,
+			GenesisTime:    1666137600,
+			GenesisAddress: "SMJ12qn9jNCCXJnTYRz5Yu9ZenERqvYwfg",
+			GenesisNonce:   64,
+			Checkpoints:    map[int]string{},
+			AssumeUTXO:     map[string]string{},
+		},
+		"test": {
+			Name:           "test",
+			ChainId:        "simple-coin-test",
+			AddressVersion: 0x7f,
+			GenesisTime:    1666137600,
+			GenesisAddress: "t6vc3nrbAurGs3i17HJUavZuw4ioKTiFCE",
+			GenesisNonce:   122,
+			Checkpoints:    map[int]string{},
+			AssumeUTXO:     map[string]string{},
+		},
+	}
+	params = networks["main"]
+)
+
+func SetNetwork(name string) error {
+	network, ok := networks[name]
+	if !ok {
+		return errors.New("Unknown network")
+	}
+	params = network
+	wallet.SetAddressVersion(network.AddressVersion)
+	return nil
+}
+
+// SetAssumeValid sets the assume-valid block of the network. "0" turns it
+// off.
+func SetAssumeValid(hash string) {
+	if hash == "0" {
+		hash = ""
+	}
+	params.AssumeValid = hash
+}
+
+// SetAssumeUTXO pins a snapshot the operator trusts, given as
+// <block hash>:<UTXO hash> like dumputxo prints them.
+func SetAssumeUTXO(pin string) error {
+	blockHash, utxoHash, ok := strings.Cut(pin, ":")
+	if !ok || blockHash == "" || utxoHash == "" {
+		return errors.New("Snapshot pin should be <block hash>:<UTXO hash>")
+	}
+	params.AssumeUTXO[blockHash] = utxoHash
+	return nil
+}
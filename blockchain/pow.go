@@ -0,0 +1,170 @@
+package blockchain
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	miningWorkers int    = runtime.NumCPU()
+	nonceRange    int    = 1 << 20 // nonces a worker tries before rolling the header
+	stopCheck     int    = 1 << 10 // how often workers look for a stop signal
+	hashCount     uint64 = 0
+)
+
+func SetMiningWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	miningWorkers = workers
+}
+
+func MiningWorkers() int {
+	return miningWorkers
+}
+
+// HashCount is the number of block hashes tried so far by this node.
+func HashCount() uint64 {
+	return atomic.LoadUint64(&hashCount)
+}
+
+// Mine searches for a nonce meeting the difficulty with miningWorkers
+// goroutines, each one owning a slice of the nonce space. All of them stop
+// at the first solution, or with false as soon as stop is closed.
+func (b *Block) Mine(stop <-chan struct{}) bool {
+	workers := miningWorkers
+	quit := make(chan struct{})
+	solutions := make(chan *Block, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			b.searchNonces(worker, quit, solutions)
+		}(i)
+	}
+
+	var found *Block
+	select {
+	case found = <-solutions:
+	case <-stop:
+	}
+	close(quit)
+	wg.Wait()
+	if found == nil {
+		return false
+	}
+	*b = *found
+	return true
+}
+
+func (b *Block) searchNonces(worker int, quit <-chan struct{}, solutions chan<- *Block) {
+	difficulty := strings.Repeat("0", b.Difficulty)
+	candidate := *b
+	candidate.Timestamp = int(time.Now().Unix())
+	extraNonce := 0
+	start := worker * nonceRange
+	for {
+		for nonce := start; nonce < start+nonceRange; nonce++ {
+			if nonce%stopCheck == 0 {
+				select {
+				case <-quit:
+					return
+				default:
+				}
+			}
+			candidate.Nonce = nonce
+			hash := candidate.calcHash()
+			atomic.AddUint64(&hashCount, 1)
+			if strings.HasPrefix(hash, difficulty) {
+				candidate.Hash = hash
+				solutions <- &candidate
+				return
+			}
+		}
+		// The range is exhausted for this header, so change the header.
+		if now := int(time.Now().Unix()); now > candidate.Timestamp {
+			candidate.Timestamp = now
+		} else {
+			extraNonce += 1
+			candidate.rollExtraNonce(extraNonce)
+		}
+	}
+}
+
+// SetSolution puts a nonce and timestamp found outside the node on the
+// block and rehashes it.
+func (b *Block) SetSolution(nonce int, timestamp int) {
+	b.Nonce = nonce
+	b.Timestamp = timestamp
+	b.Hash = b.calcHash()
+}
+
+// Target is the hash a block must not exceed, as hex.
+func (b *Block) Target() string {
+	if b.Difficulty > 64 {
+		return strings.Repeat("0", 64)
+	}
+	return strings.Repeat("0", b.Difficulty) + strings.Repeat("f", 64-b.Difficulty)
+}
+
+// CoinbaseValue is what the coinbase of the block pays out.
+func (b *Block) CoinbaseValue() int {
+	var value int
+	if len(b.Transactions) == 0 {
+		return value
+	}
+	for _, txOut := range b.Transactions[len(b.Transactions)-1].TxOuts {
+		value += txOut.Amount
+	}
+	return value
+}
+
+// SetCoinbaseOutputs replaces what the coinbase of a template pays out and
+// updates the merkle roots.
+func (b *Block) SetCoinbaseOutputs(outs []*TxOut) {
+	last := len(b.Transactions) - 1
+	coinbase := *b.Transactions[last]
+	coinbase.TxOuts = outs
+	coinbase.calcId()
+	coinbase.calcWitnessHash()
+
+	txs := append([]*Tx{}, b.Transactions...)
+	txs[last] = &coinbase
+	b.Transactions = txs
+	b.MerkleRoot, b.WitnessRoot = txRoots(txs)
+}
+
+// rollExtraNonce changes the coinbase, and so the merkle roots, of a
+// block whose last transaction is its coinbase.
+func (b *Block) rollExtraNonce(extraNonce int) {
+	b.setCoinbaseData(fmt.Sprintf("%d:%d", b.Height, extraNonce))
+}
+
+// TagCoinbase puts tag in the coinbase of a template, so templates handed
+// to different miners get different ids.
+func (b *Block) TagCoinbase(tag string) {
+	b.setCoinbaseData(fmt.Sprintf("%d:%s", b.Height, tag))
+}
+
+func (b *Block) setCoinbaseData(data string) {
+	last := len(b.Transactions) - 1
+	if last < 0 || len(b.Transactions[last].TxIns) != 1 || b.Transactions[last].TxIns[0].Index != -1 {
+		return
+	}
+	coinbase := *b.Transactions[last]
+	coinbaseIn := *coinbase.TxIns[0]
+	coinbaseIn.Coinbase = data
+	coinbase.TxIns = []*TxIn{&coinbaseIn}
+	coinbase.calcId()
+	coinbase.calcWitnessHash()
+
+	txs := append([]*Tx{}, b.Transactions...)
+	txs[last] = &coinbase
+	b.Transactions = txs
+	b.MerkleRoot, b.WitnessRoot = txRoots(txs)
+}
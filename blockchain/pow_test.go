@@ -0,0 +1,82 @@
+package blockchain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParallelMine(t *testing.T) {
+	defer func(workers, rangeSize int) {
+		miningWorkers, nonceRange = workers, rangeSize
+	}(miningWorkers, nonceRange)
+	SetMiningWorkers(4)
+	nonceRange = 16
+	w = testWallet{}
+
+	coinbase := makeCoinbaseTx(1, 0)
+	b := &Block{Height: 1, Difficulty: 3, Transactions: []*Tx{coinbase}}
+	b.MerkleRoot, b.WitnessRoot = txRoots(b.Transactions)
+	if !b.Mine(nil) {
+		t.Fatal("should find a block")
+	}
+	if !strings.HasPrefix(b.Hash, "000") {
+		t.Errorf("Expected a hash starting with 000, Got: %s", b.Hash)
+	}
+	if !b.verifyCommitments() {
+		t.Error("mined block should keep valid commitments after rolling the header")
+	}
+}
+
+func TestRollExtraNonce(t *testing.T) {
+	w = testWallet{}
+	coinbase := makeCoinbaseTx(1, 0)
+	b := &Block{Height: 1, Transactions: []*Tx{coinbase}}
+	b.MerkleRoot, b.WitnessRoot = txRoots(b.Transactions)
+	root := b.MerkleRoot
+	b.rollExtraNonce(1)
+	if b.MerkleRoot == root {
+		t.Error("merkle root should change")
+	}
+	if coinbase.TxIns[0].Coinbase != "1" {
+		t.Error("template coinbase should not be modified")
+	}
+}
+
+func TestTagCoinbase(t *testing.T) {
+	w = testWallet{}
+	b := &Block{Height: 1, Transactions: []*Tx{makeCoinbaseTx(1, 0)}}
+	other := *b
+	b.TagCoinbase("a")
+	other.TagCoinbase("b")
+	if b.MerkleRoot == other.MerkleRoot {
+		t.Error("templates tagged for different miners should differ")
+	}
+	if merkleRoot, _ := txRoots(b.Transactions); b.MerkleRoot != merkleRoot {
+		t.Error("merkle root should commit to the tagged coinbase")
+	}
+}
+
+func TestSetMiningWorkers(t *testing.T) {
+	defer func(workers int) { miningWorkers = workers }(miningWorkers)
+	SetMiningWorkers(0)
+	if MiningWorkers() != 1 {
+		t.Errorf("Expected: 1, Got: %d", MiningWorkers())
+	}
+}
+
+func TestSetSolution(t *testing.T) {
+	b := &Block{Difficulty: 1}
+	b.Mine(nil)
+	solved := &Block{Difficulty: 1}
+	solved.SetSolution(b.Nonce, b.Timestamp)
+	if solved.Hash != b.Hash {
+		t.Errorf("Expected: %s, Got: %s", b.Hash, solved.Hash)
+	}
+}
+
+func TestTarget(t *testing.T) {
+	target := (&Block{Difficulty: 2}).Target()
+	if len(target) != 64 || !strings.HasPrefix(target, "00f") {
+		t.Errorf("Expected: 00fff..., Got: %s", target)
+	}
+}
@@ -0,0 +1,72 @@
+package blockchain
+
+import "github.com/fantasticake/simple-coin/utils"
+
+// minBlocksToKeep is how many recent blocks a pruned node always keeps, so
+// it can still serve them and handle short reorgs.
+const minBlocksToKeep = 288
+
+// pruneTarget is how many bytes of block bodies to keep, 0 disables pruning.
+var pruneTarget int
+
+func SetPruneTarget(mb int) {
+	pruneTarget = mb * 1024 * 1024
+}
+
+func IsPruned(b *blockchain) bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.PrunedHeight > 0
+}
+
+func PrunedHeight(b *blockchain) int {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.PrunedHeight
+}
+
+// prune deletes the oldest block bodies while the stored blocks exceed the
+// prune target. Headers, the UTXO set and the undo data of recent blocks
+// are kept.
+func (b *blockchain) prune() {
+	if pruneTarget == 0 {
+		return
+	}
+	size := storage.BlocksSize()
+	if size <= pruneTarget {
+		return
+	}
+	pruneHeight := GetHeight(b) - minBlocksToKeep
+	headers := b.headersFrom(PrunedHeight(b) + 1)
+	prunedHeight := PrunedHeight(b)
+	for _, header := range headers {
+		if size <= pruneTarget || header.Height > pruneHeight {
+			break
+		}
+		size -= storage.DeleteBlock([]byte(header.Hash))
+		prunedHeight = header.Height
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.PrunedHeight = prunedHeight
+	PersistBlockchain(b)
+}
+
+// headersFrom returns the headers from height up to the tip, oldest first.
+func (b *blockchain) headersFrom(height int) []*Block {
+	b.m.Lock()
+	defer b.m.Unlock()
+	var headers []*Block
+	hashCursor := b.LastHash
+	for hashCursor != "" {
+		header, err := findHeader(hashCursor)
+		utils.HandleErr(err)
+		if header.Height < height {
+			break
+		}
+		headers = append([]*Block{header}, headers...)
+		hashCursor = header.PrevHash
+	}
+	return headers
+}
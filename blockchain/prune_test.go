@@ -0,0 +1,83 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/fantasticake/simple-coin/utils"
+)
+
+// pruneStorage keeps headers in memory and records deleted block bodies.
+type pruneStorage struct {
+	testStorage
+	headers map[string]*Block
+	size    int
+	deleted []string
+}
+
+func (s *pruneStorage) FindHeader(key []byte) ([]byte, error) {
+	return utils.ToBytes(s.headers[string(key)]), nil
+}
+func (s *pruneStorage) DeleteBlock(key []byte) int {
+	s.deleted = append(s.deleted, string(key))
+	return 1
+}
+func (s *pruneStorage) BlocksSize() int { return s.size }
+
+func TestPrune(t *testing.T) {
+	defer func() { pruneTarget = 0; storage = testStorage{} }()
+	newStorage := func(height int) *pruneStorage {
+		s := &pruneStorage{headers: map[string]*Block{}, size: height}
+		prevHash := ""
+		for i := 1; i <= height; i++ {
+			hash := utils.HashJson(i)
+			s.headers[hash] = &Block{Hash: hash, PrevHash: prevHash, Height: i}
+			prevHash = hash
+		}
+		s.testStorage.fakeFindBlock = func(key []byte) ([]byte, error) {
+			return utils.ToBytes(s.headers[string(key)]), nil
+		}
+		return s
+	}
+	tip := func(s *pruneStorage, height int) string {
+		for hash, header := range s.headers {
+			if header.Height == height {
+				return hash
+			}
+		}
+		return ""
+	}
+
+	t.Run("should keep everything when pruning is off", func(t *testing.T) {
+		pruneTarget = 0
+		s := newStorage(300)
+		storage = s
+		tb := &blockchain{LastHash: tip(s, 300)}
+		tb.prune()
+		if len(s.deleted) != 0 || IsPruned(tb) {
+			t.Errorf("Expected no pruning, Got: %d blocks deleted", len(s.deleted))
+		}
+	})
+	t.Run("should delete the oldest blocks down to the target", func(t *testing.T) {
+		pruneTarget = 295
+		s := newStorage(300)
+		storage = s
+		tb := &blockchain{LastHash: tip(s, 300)}
+		tb.prune()
+		if len(s.deleted) != 5 || PrunedHeight(tb) != 5 {
+			t.Errorf("Expected: 5 blocks pruned, Got: %d, pruned height %d", len(s.deleted), PrunedHeight(tb))
+		}
+		if s.deleted[0] != tip(s, 1) {
+			t.Error("should delete the genesis block first")
+		}
+	})
+	t.Run("should keep the recent blocks", func(t *testing.T) {
+		pruneTarget = 1
+		s := newStorage(300)
+		storage = s
+		tb := &blockchain{LastHash: tip(s, 300)}
+		tb.prune()
+		if PrunedHeight(tb) != 300-minBlocksToKeep {
+			t.Errorf("Expected pruned height: %d, Got: %d", 300-minBlocksToKeep, PrunedHeight(tb))
+		}
+	})
+}
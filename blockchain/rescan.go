@@ -0,0 +1,53 @@
+package blockchain
+
+import (
+	"github.com/fantasticake/simple-coin/utils"
+	"github.com/fantasticake/simple-coin/wallet"
+)
+
+// RescanWallet looks through the stored chain for outputs paying wl, so a
+// restored wallet watches every address it used. Pruned block bodies are
+// skipped, their unspent outputs are still in the UTXO set. It returns how
+// many wallet addresses were paid.
+func RescanWallet(wl *wallet.W) (int, error) {
+	stored, err := storedChain()
+	if err != nil {
+		return 0, err
+	}
+	headers, err := storedHeaders(stored.LastHash)
+	if err != nil {
+		return 0, err
+	}
+	var paid []string
+	for _, header := range headers {
+		block, err := FindBlock(header.Hash)
+		if err != nil {
+			continue
+		}
+		for _, tx := range block.Transactions {
+			for _, txOut := range tx.TxOuts {
+				paid = append(paid, txOut.Address)
+			}
+		}
+	}
+	storage.ForEachUTxOut(func(key []byte, data []byte) {
+		txOut := &TxOut{}
+		utils.FromBytes(txOut, data)
+		paid = append(paid, txOut.Address)
+	})
+
+	// Each used address makes the wallet watch further ones, which earlier
+	// outputs may pay, so scan until no more turn up.
+	used := make(map[string]bool)
+	for found := true; found; {
+		found = false
+		for _, address := range paid {
+			if address != "" && !used[address] && w.Watches(wl, address) {
+				w.MarkUsed(wl, address)
+				used[address] = true
+				found = true
+			}
+		}
+	}
+	return len(used), nil
+}
@@ -0,0 +1,51 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/fantasticake/simple-coin/wallet"
+)
+
+// gapWallet owns its addresses one past the last used one, like a wallet
+// restored from a seed.
+type gapWallet struct {
+	testWallet
+	addresses []string
+	used      *int
+}
+
+func (g gapWallet) Watches(w *wallet.W, address string) bool {
+	for index, owned := range g.addresses {
+		if owned == address {
+			return index <= *g.used
+		}
+	}
+	return false
+}
+func (g gapWallet) MarkUsed(w *wallet.W, address string) {
+	for index, owned := range g.addresses {
+		if owned == address && index >= *g.used {
+			*g.used = index + 1
+		}
+	}
+}
+
+func TestRescanWallet(t *testing.T) {
+	defer withParams(&chainParams{ChainId: "test", Checkpoints: map[int]string{}})()
+	defer func() { storage = testStorage{} }()
+	defer SetMiningAddress("")
+
+	SetMiningAddress("miner")
+	storeTestChain()
+	used := 0
+	w = gapWallet{addresses: []string{"miner", toAddress, "unused"}, used: &used}
+	defer func() { w = testWallet{} }()
+
+	found, err := RescanWallet(w.Wallet())
+	if err != nil || found != 2 {
+		t.Errorf("Expected: 2 addresses, Got: %d %v", found, err)
+	}
+	if used != 2 {
+		t.Errorf("should watch past the last used address, Expected: 2, Got: %d", used)
+	}
+}
@@ -0,0 +1,118 @@
+package blockchain
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/fantasticake/simple-coin/utils"
+)
+
+const (
+	SigHashAll          = 0x01
+	SigHashNone         = 0x02
+	SigHashSingle       = 0x03
+	SigHashAnyoneCanPay = 0x80
+)
+
+var (
+	sigHashNames = map[string]int{"ALL": SigHashAll, "NONE": SigHashNone, "SINGLE": SigHashSingle}
+
+	errBadSigHash     = errors.New("Invalid sighash type")
+	errNoSingleOutput = errors.New("No output matches the input index for SIGHASH_SINGLE")
+)
+
+// sigHashData is what a signature of a single input commits to.
+type sigHashData struct {
+	ChainId   string  `json:"chainId"`
+	Timestamp int     `json:"timestamp"`
+	TxIns     []TxIn  `json:"txIns"`
+	TxOuts    []TxOut `json:"txOuts"`
+	Index     int     `json:"index"`
+	Spent     TxOut   `json:"spent"`
+	SigHash   int     `json:"sigHash"`
+}
+
+func validSigHash(sigHash int) bool {
+	base := sigHash &^ SigHashAnyoneCanPay
+	return base >= SigHashAll && base <= SigHashSingle
+}
+
+// ParseSigHash turns names like "ALL" or "SINGLE|ANYONECANPAY" into a
+// sighash type: exactly one of ALL, NONE and SINGLE, optionally with
+// ANYONECANPAY. An empty string means SIGHASH_ALL.
+func ParseSigHash(name string) (int, error) {
+	if name == "" {
+		return SigHashAll, nil
+	}
+	base, anyoneCanPay := 0, false
+	for _, part := range strings.Split(strings.ToUpper(name), "|") {
+		part = strings.TrimSpace(part)
+		switch part {
+		case "ALL", "NONE", "SINGLE":
+			if base != 0 {
+				return 0, errBadSigHash
+			}
+			base = sigHashNames[part]
+		case "ANYONECANPAY":
+			if anyoneCanPay {
+				return 0, errBadSigHash
+			}
+			anyoneCanPay = true
+		default:
+			return 0, errBadSigHash
+		}
+	}
+	if base == 0 {
+		return 0, errBadSigHash
+	}
+	if anyoneCanPay {
+		return base | SigHashAnyoneCanPay, nil
+	}
+	return base, nil
+}
+
+func stripWitness(txIn *TxIn) TxIn {
+	return TxIn{
+		Address:  txIn.Address,
+		TxId:     txIn.TxId,
+		Index:    txIn.Index,
+		Coinbase: txIn.Coinbase,
+	}
+}
+
+// sigHash returns the digest signed by the input at index, which spends the
+// output spent.
+func (t *Tx) sigHash(index int, spent *TxOut, sigHash int) (string, error) {
+	if !validSigHash(sigHash) {
+		return "", errBadSigHash
+	}
+	data := sigHashData{
+		ChainId:   params.ChainId,
+		Timestamp: t.Timestamp,
+		Index:     index,
+		Spent:     *spent,
+		SigHash:   sigHash,
+	}
+
+	if sigHash&SigHashAnyoneCanPay != 0 {
+		data.TxIns = []TxIn{stripWitness(t.TxIns[index])}
+	} else {
+		for _, txIn := range t.TxIns {
+			data.TxIns = append(data.TxIns, stripWitness(txIn))
+		}
+	}
+
+	switch sigHash &^ SigHashAnyoneCanPay {
+	case SigHashAll:
+		for _, txOut := range t.TxOuts {
+			data.TxOuts = append(data.TxOuts, *txOut)
+		}
+	case SigHashSingle:
+		if index >= len(t.TxOuts) {
+			return "", errNoSingleOutput
+		}
+		data.TxOuts = []TxOut{*t.TxOuts[index]}
+	}
+
+	return utils.HashJson(data), nil
+}
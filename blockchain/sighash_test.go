@@ -0,0 +1,103 @@
+package blockchain
+
+import "testing"
+
+func TestParseSigHash(t *testing.T) {
+	t.Run("should default to SIGHASH_ALL", func(t *testing.T) {
+		sigHash, err := ParseSigHash("")
+		if err != nil || sigHash != SigHashAll {
+			t.Errorf("Expected: %d, Got: %d", SigHashAll, sigHash)
+		}
+	})
+	t.Run("should combine ANYONECANPAY", func(t *testing.T) {
+		sigHash, err := ParseSigHash("single|anyonecanpay")
+		if err != nil || sigHash != SigHashSingle|SigHashAnyoneCanPay {
+			t.Errorf("Expected: %d, Got: %d", SigHashSingle|SigHashAnyoneCanPay, sigHash)
+		}
+	})
+	t.Run("should reject unknown names", func(t *testing.T) {
+		if _, err := ParseSigHash("SOME"); err == nil {
+			t.Error("should return an error")
+		}
+	})
+	t.Run("should reject combined base types", func(t *testing.T) {
+		for _, name := range []string{"ALL|NONE", "ALL|ALL", "NONE|SINGLE|ANYONECANPAY", "ALL|ANYONECANPAY|ANYONECANPAY"} {
+			if _, err := ParseSigHash(name); err != errBadSigHash {
+				t.Errorf("%s: Expected: %v, Got: %v", name, errBadSigHash, err)
+			}
+		}
+	})
+	t.Run("should reject ANYONECANPAY alone", func(t *testing.T) {
+		if _, err := ParseSigHash("ANYONECANPAY"); err == nil {
+			t.Error("should return an error")
+		}
+	})
+}
+
+func TestSigHash(t *testing.T) {
+	spent := &TxOut{Address: "owner", Amount: 5}
+	newTx := func() *Tx {
+		return &Tx{
+			TxIns:  []*TxIn{{TxId: "a", Index: 0}, {TxId: "b", Index: 1}},
+			TxOuts: []*TxOut{{Address: "x", Amount: 3}, {Address: "y", Amount: 2}},
+		}
+	}
+	digest := func(tx *Tx, index int, sigHash int) string {
+		d, err := tx.sigHash(index, spent, sigHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	t.Run("should commit to the spent output", func(t *testing.T) {
+		tx := newTx()
+		d1 := digest(tx, 0, SigHashAll)
+		d2, _ := tx.sigHash(0, &TxOut{Address: "owner", Amount: 6}, SigHashAll)
+		if d1 == d2 {
+			t.Error("digest should change with the spent amount")
+		}
+	})
+	t.Run("should be different for each input", func(t *testing.T) {
+		tx := newTx()
+		if digest(tx, 0, SigHashAll) == digest(tx, 1, SigHashAll) {
+			t.Error("inputs should not share a digest")
+		}
+	})
+	t.Run("SIGHASH_ALL should commit to every output", func(t *testing.T) {
+		tx := newTx()
+		d := digest(tx, 0, SigHashAll)
+		tx.TxOuts[1].Amount = 1
+		if d == digest(tx, 0, SigHashAll) {
+			t.Error("digest should change with outputs")
+		}
+	})
+	t.Run("SIGHASH_NONE should not commit to outputs", func(t *testing.T) {
+		tx := newTx()
+		d := digest(tx, 0, SigHashNone)
+		tx.TxOuts[1].Amount = 1
+		if d != digest(tx, 0, SigHashNone) {
+			t.Error("digest should not change with outputs")
+		}
+	})
+	t.Run("SIGHASH_SINGLE should only commit to its own output", func(t *testing.T) {
+		tx := newTx()
+		d := digest(tx, 0, SigHashSingle)
+		tx.TxOuts[1].Amount = 1
+		if d != digest(tx, 0, SigHashSingle) {
+			t.Error("digest should not change with other outputs")
+		}
+		tx.TxOuts = tx.TxOuts[:1]
+		if _, err := tx.sigHash(1, spent, SigHashSingle); err == nil {
+			t.Error("should fail without a matching output")
+		}
+	})
+	t.Run("ANYONECANPAY should allow adding inputs", func(t *testing.T) {
+		tx := newTx()
+		d := digest(tx, 0, SigHashAll|SigHashAnyoneCanPay)
+		tx.TxIns = append(tx.TxIns, &TxIn{TxId: "c", Index: 0})
+		if d != digest(tx, 0, SigHashAll|SigHashAnyoneCanPay) {
+			t.Error("digest should not change with other inputs")
+		}
+	})
+}
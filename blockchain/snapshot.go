@@ -0,0 +1,275 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/fantasticake/simple-coin/utils"
+)
+
+// A UTXO snapshot is a bootstrap file made of a SnapshotInfo record, the
+// headers from genesis up to the snapshot block, the snapshot block itself
+// and then one record per unspent output, sorted by outpoint.
+
+// SnapshotInfo describes the UTXO set at a block.
+type SnapshotInfo struct {
+	BlockHash string `json:"blockHash"`
+	Height    int    `json:"height"`
+	UTXOCount int    `json:"utxoCount"`
+	UTXOHash  string `json:"utxoHash"`
+}
+
+type snapshotEntry struct {
+	Outpoint string `json:"outpoint"`
+	TxOut    *TxOut `json:"txOut"`
+}
+
+var (
+	errBadHeight         = errors.New("Height is out of the chain")
+	errChainExists       = errors.New("Snapshots can only be loaded into an empty node")
+	errUnknownSnapshot   = errors.New("Snapshot is not pinned in the chain params")
+	errBadSnapshot       = errors.New("Snapshot does not match its hash")
+	errNoHistory         = errors.New("Blocks do not lead to the snapshot block")
+	errHistoryMismatch   = errors.New("History does not lead to the snapshot UTXO set")
+	errNoSnapshot        = errors.New("Blockchain is not running on a snapshot")
+	errValidatingHistory = errors.New("History is already being validated")
+
+	historyM sync.Mutex
+)
+
+// snapshotHash hashes the entries in order.
+func snapshotHash(entries []snapshotEntry) string {
+	h := sha256.New()
+	for _, entry := range entries {
+		h.Write(utils.ToJson(entry))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// sortedEntries turns a UTXO set into entries sorted by outpoint.
+func sortedEntries(utxos map[string]*TxOut) []snapshotEntry {
+	entries := make([]snapshotEntry, 0, len(utxos))
+	for key, txOut := range utxos {
+		entries = append(entries, snapshotEntry{key, txOut})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Outpoint < entries[j].Outpoint })
+	return entries
+}
+
+// utxoSetAt rebuilds the UTXO set at height by undoing the blocks above it.
+func utxoSetAt(headers []*Block, height int) (map[string]*TxOut, error) {
+	utxos := make(map[string]*TxOut)
+	storage.ForEachUTxOut(func(key []byte, data []byte) {
+		txOut := &TxOut{}
+		utils.FromBytes(txOut, data)
+		utxos[string(key)] = txOut
+	})
+	for i := len(headers) - 1; i >= 0 && headers[i].Height > height; i-- {
+		block, err := FindBlock(headers[i].Hash)
+		if err != nil {
+			return nil, errPrunedChain
+		}
+		undoAsB, err := storage.FindUndo([]byte(block.Hash))
+		if err != nil {
+			return nil, errPrunedChain
+		}
+		var undo []spentOutput
+		utils.FromBytes(&undo, undoAsB)
+		for _, tx := range block.Transactions {
+			for index := range tx.TxOuts {
+				delete(utxos, outpoint(tx.Id, index))
+			}
+		}
+		for _, spent := range undo {
+			utxos[spent.Outpoint] = spent.TxOut
+		}
+	}
+	return utxos, nil
+}
+
+// DumpUTXO writes a snapshot of the UTXO set at height to w, 0 meaning the
+// tip.
+func DumpUTXO(w io.Writer, height int) (*SnapshotInfo, error) {
+	stored, err := storedChain()
+	if err != nil {
+		return nil, err
+	}
+	headers, err := storedHeaders(stored.LastHash)
+	if err != nil {
+		return nil, err
+	}
+	if height == 0 {
+		height = len(headers)
+	}
+	if height < 1 || height > len(headers) {
+		return nil, errBadHeight
+	}
+	utxos, err := utxoSetAt(headers, height)
+	if err != nil {
+		return nil, err
+	}
+	block, err := FindBlock(headers[height-1].Hash)
+	if err != nil {
+		return nil, errPrunedChain
+	}
+
+	entries := sortedEntries(utxos)
+	info := &SnapshotInfo{
+		BlockHash: block.Hash,
+		Height:    height,
+		UTXOCount: len(entries),
+		UTXOHash:  snapshotHash(entries),
+	}
+	records := [][]byte{utils.ToJson(info)}
+	for _, header := range headers[:height] {
+		records = append(records, utils.ToJson(header))
+	}
+	records = append(records, utils.ToJson(block))
+	for _, entry := range entries {
+		records = append(records, utils.ToJson(entry))
+	}
+	for _, record := range records {
+		if err := writeRecord(w, record); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+func readJsonRecord(r io.Reader, v any) error {
+	record, err := readRecord(r)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(record, v)
+}
+
+// LoadSnapshot makes an empty node start from a pinned UTXO snapshot read
+// from r. Blocks below the snapshot are missing until ValidateHistory
+// checks them.
+func LoadSnapshot(r io.Reader) (*SnapshotInfo, error) {
+	if _, err := storedChain(); err == nil {
+		return nil, errChainExists
+	}
+	info := &SnapshotInfo{}
+	if err := readJsonRecord(r, info); err != nil {
+		return nil, err
+	}
+	if pinned, ok := params.AssumeUTXO[info.BlockHash]; !ok || pinned != info.UTXOHash {
+		return nil, errUnknownSnapshot
+	}
+
+	headers := make(map[string][]byte)
+	var chain []*Block
+	for i := 0; i < info.Height; i++ {
+		header := &Block{}
+		if err := readJsonRecord(r, header); err != nil {
+			return nil, err
+		}
+		var prev *Block
+		if i > 0 {
+			prev = chain[i-1]
+		}
+		if err := verifyHeader(header, prev, chain); err != nil {
+			return nil, fmt.Errorf("Header %d: %w", header.Height, err)
+		}
+		chain = append(chain, header)
+		headers[header.Hash] = utils.ToBytes(header)
+	}
+	block := &Block{}
+	if err := readJsonRecord(r, block); err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 || block.Hash != info.BlockHash || chain[len(chain)-1].Hash != block.Hash || !block.verifyCommitments() {
+		return nil, errBadSnapshot
+	}
+
+	entries := make([]snapshotEntry, info.UTXOCount)
+	utxos := make(map[string][]byte)
+	for i := range entries {
+		if err := readJsonRecord(r, &entries[i]); err != nil {
+			return nil, err
+		}
+		utxos[entries[i].Outpoint] = utils.ToBytes(entries[i].TxOut)
+	}
+	if snapshotHash(entries) != info.UTXOHash {
+		return nil, errBadSnapshot
+	}
+
+	storage.LoadSnapshot(headers, []byte(block.Hash), utils.ToBytes(block), utxos)
+	PersistBlockchain(&blockchain{
+		LastHash:       block.Hash,
+		PrunedHeight:   info.Height - 1,
+		SnapshotHeight: info.Height,
+	})
+	return info, nil
+}
+
+func NeedsHistory(b *blockchain) bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.SnapshotHeight > 0
+}
+
+// ValidateHistory checks the blocks leading to the loaded snapshot, given
+// from the tip down as peers send them. If they rebuild the snapshot's UTXO
+// set, their bodies and undo data are stored and the node stops relying on
+// the snapshot.
+func (b *blockchain) ValidateHistory(blocks []*Block) error {
+	if !historyM.TryLock() {
+		return errValidatingHistory
+	}
+	defer historyM.Unlock()
+	b.m.Lock()
+	snapshotHeight, lastHash := b.SnapshotHeight, b.LastHash
+	b.m.Unlock()
+	if snapshotHeight == 0 {
+		return errNoSnapshot
+	}
+	headers, err := storedHeaders(lastHash)
+	if err != nil {
+		return err
+	}
+	snapshotBlock := headers[snapshotHeight-1].Hash
+
+	var chain []*Block
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if blocks[i].Height <= snapshotHeight {
+			chain = append(chain, blocks[i])
+		}
+	}
+	if len(chain) != snapshotHeight || chain[len(chain)-1].Hash != snapshotBlock {
+		return errNoHistory
+	}
+	if err := validateChain(chain); err != nil {
+		return err
+	}
+	view := utxoView{}
+	undos := make([][]spentOutput, len(chain))
+	for i, block := range chain {
+		undos[i] = view.undo(block)
+		view.apply(block)
+	}
+	if snapshotHash(sortedEntries(view)) != params.AssumeUTXO[snapshotBlock] {
+		return errHistoryMismatch
+	}
+
+	for i, block := range chain {
+		storage.ConnectBlock([]byte(block.Hash), utils.ToBytes(block), utils.ToBytes(block.withoutTxs()), utils.ToBytes(undos[i]), nil, nil)
+	}
+
+	b.m.Lock()
+	b.PrunedHeight = 0
+	b.SnapshotHeight = 0
+	PersistBlockchain(b)
+	b.m.Unlock()
+	b.prune()
+	return nil
+}
@@ -0,0 +1,109 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUTXOSnapshot(t *testing.T) {
+	defer withParams(&chainParams{ChainId: "test", Checkpoints: map[int]string{}, AssumeUTXO: map[string]string{}})()
+	defer func() { storage = testStorage{} }()
+
+	_, chain := storeTestChain()
+	var file bytes.Buffer
+	info, err := DumpUTXO(&file, 0)
+	if err != nil || info.Height != 2 || info.UTXOCount != 2 {
+		t.Fatalf("Expected: 2 outputs at height 2, Got: %+v %v", info, err)
+	}
+	data := file.Bytes()
+
+	t.Run("should rebuild an older UTXO set", func(t *testing.T) {
+		storeTestChain()
+		old, err := DumpUTXO(&bytes.Buffer{}, 1)
+		if err != nil || old.BlockHash != chain[0].Hash || old.UTXOCount != 1 {
+			t.Errorf("Expected: 1 output at genesis, Got: %+v %v", old, err)
+		}
+	})
+	t.Run("should refuse a snapshot that is not pinned", func(t *testing.T) {
+		storage = newMemStorage()
+		if _, err := LoadSnapshot(bytes.NewReader(data)); err != errUnknownSnapshot {
+			t.Errorf("Expected: %v, Got: %v", errUnknownSnapshot, err)
+		}
+	})
+	if err := SetAssumeUTXO(info.BlockHash); err == nil {
+		t.Error("should refuse a pin without UTXO hash")
+	}
+	if err := SetAssumeUTXO(info.BlockHash + ":" + info.UTXOHash); err != nil {
+		t.Fatalf("Expected: nil, Got: %v", err)
+	}
+	t.Run("should refuse a tampered snapshot", func(t *testing.T) {
+		storage = newMemStorage()
+		tampered := bytes.Replace(data, []byte(`"amount":9`), []byte(`"amount":8`), 1)
+		if _, err := LoadSnapshot(bytes.NewReader(tampered)); err != errBadSnapshot {
+			t.Errorf("Expected: %v, Got: %v", errBadSnapshot, err)
+		}
+	})
+	t.Run("should load a pinned snapshot and validate its history", func(t *testing.T) {
+		storage = newMemStorage()
+		if _, err := LoadSnapshot(bytes.NewReader(data)); err != nil {
+			t.Fatalf("Expected: nil, Got: %v", err)
+		}
+		tb, _ := storedChain()
+		if !NeedsHistory(tb) || tb.LastHash != chain[1].Hash {
+			t.Fatalf("Expected a snapshot chain at %s, Got: %+v", chain[1].Hash, tb)
+		}
+		if _, err := VerifyChain(CheckBodies, 1); err != nil {
+			t.Errorf("Expected: nil, Got: %v", err)
+		}
+		if _, err := VerifyChain(CheckBodies, 0); err != errPrunedChain {
+			t.Errorf("Expected: %v, Got: %v", errPrunedChain, err)
+		}
+		if _, err := LoadSnapshot(bytes.NewReader(data)); err != errChainExists {
+			t.Errorf("Expected: %v, Got: %v", errChainExists, err)
+		}
+
+		if err := tb.ValidateHistory([]*Block{chain[0]}); err != errNoHistory {
+			t.Errorf("Expected: %v, Got: %v", errNoHistory, err)
+		}
+		if err := tb.ValidateHistory([]*Block{chain[1], chain[0]}); err != nil {
+			t.Fatalf("Expected: nil, Got: %v", err)
+		}
+		if NeedsHistory(tb) {
+			t.Error("should stop relying on the snapshot")
+		}
+		if _, err := VerifyChain(CheckUTXO, 0); err != nil {
+			t.Errorf("Expected: nil, Got: %v", err)
+		}
+	})
+}
+
+func TestPinnedSnapshot(t *testing.T) {
+	network := *networks["test"]
+	network.AssumeUTXO = map[string]string{}
+	defer withParams(&network)()
+	defer func() { storage = testStorage{} }()
+
+	storage = newMemStorage()
+	w = testWallet{}
+	genesis := genesisBlock(params)
+	persistBlock(genesis)
+	PersistBlockchain(&blockchain{LastHash: genesis.Hash})
+	var file bytes.Buffer
+	dumped, err := DumpUTXO(&file, 0)
+	if err != nil {
+		t.Fatalf("Expected: nil, Got: %v", err)
+	}
+	if err := SetAssumeUTXO(dumped.BlockHash + ":" + dumped.UTXOHash); err != nil {
+		t.Fatalf("Expected: nil, Got: %v", err)
+	}
+
+	storage = newMemStorage()
+	info, err := LoadSnapshot(bytes.NewReader(file.Bytes()))
+	if err != nil || info.BlockHash != genesis.Hash {
+		t.Fatalf("Expected the genesis snapshot, Got: %+v %v", info, err)
+	}
+	tb, _ := storedChain()
+	if err := tb.ValidateHistory([]*Block{genesis}); err != nil {
+		t.Errorf("Expected: nil, Got: %v", err)
+	}
+}
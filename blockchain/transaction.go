@@ -2,6 +2,7 @@ package blockchain
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -11,8 +12,16 @@ import (
 
 type walletLayer interface {
 	Wallet() *wallet.W
-	Sign(hash string, w *wallet.W) string
-	Verify(addr string, hash string, signature string) bool
+	Wallets() []*wallet.W
+	Owns(w *wallet.W, address string) bool
+	Watches(w *wallet.W, address string) bool
+	ChangeAddress(w *wallet.W) (string, error)
+	ClaimChange(w *wallet.W, address string)
+	ReleaseChange(w *wallet.W, address string)
+	MarkUsed(w *wallet.W, address string)
+	Sign(hash string, w *wallet.W, address string) (string, error)
+	PublicKey(w *wallet.W, address string) (string, error)
+	Verify(addr string, pubKey string, hash string, signature string) bool
 }
 
 type ecWallet struct{}
@@ -20,15 +29,48 @@ type ecWallet struct{}
 func (ecWallet) Wallet() *wallet.W {
 	return wallet.Wallet()
 }
-func (ecWallet) Sign(hash string, w *wallet.W) string {
-	return wallet.Sign(hash, w)
+func (ecWallet) Wallets() []*wallet.W {
+	return wallet.Loaded()
 }
-func (ecWallet) Verify(addr string, hash string, signature string) bool {
-	return wallet.Verify(addr, hash, signature)
+func (ecWallet) Owns(w *wallet.W, address string) bool {
+	return wallet.Owns(w, address)
+}
+func (ecWallet) Watches(w *wallet.W, address string) bool {
+	return wallet.Watches(w, address)
+}
+func (ecWallet) ChangeAddress(w *wallet.W) (string, error) {
+	return wallet.ChangeAddress(w)
+}
+func (ecWallet) ClaimChange(w *wallet.W, address string) {
+	wallet.ClaimChange(w, address)
+}
+func (ecWallet) ReleaseChange(w *wallet.W, address string) {
+	wallet.ReleaseChange(w, address)
+}
+func (ecWallet) MarkUsed(w *wallet.W, address string) {
+	wallet.MarkUsed(w, address)
+}
+func (ecWallet) Sign(hash string, w *wallet.W, address string) (string, error) {
+	return wallet.Sign(hash, w, address)
+}
+func (ecWallet) PublicKey(w *wallet.W, address string) (string, error) {
+	return wallet.PublicKey(w, address)
+}
+func (ecWallet) Verify(addr string, pubKey string, hash string, signature string) bool {
+	return wallet.Verify(addr, pubKey, hash, signature)
 }
 
 type Tx struct {
-	Id        string   `json:"id"`
+	Id          string   `json:"id"`
+	WitnessHash string   `json:"witnessHash"`
+	Timestamp   int      `json:"timestamp"`
+	TxIns       []*TxIn  `json:"txIns"`
+	TxOuts      []*TxOut `json:"txOuts"`
+}
+
+// txData is the part of a transaction that is hashed into its id and
+// witness hash.
+type txData struct {
 	Timestamp int      `json:"timestamp"`
 	TxIns     []*TxIn  `json:"txIns"`
 	TxOuts    []*TxOut `json:"txOuts"`
@@ -38,18 +80,26 @@ type TxIn struct {
 	Address   string `json:"address"`
 	TxId      string `json:"txId"`
 	Index     int    `json:"index"`
+	Coinbase  string `json:"coinbase,omitempty"`
 	Signature string `json:"signature,omitempty"`
+	PubKey    string `json:"pubKey,omitempty"`
+	SigHash   int    `json:"sigHash,omitempty"`
+	Preimage  string `json:"preimage,omitempty"`
 }
 
 type TxOut struct {
 	Address string `json:"address"`
 	Amount  int    `json:"amount"`
+	HTLC    *HTLC  `json:"htlc,omitempty"`
+	Data    string `json:"data,omitempty"`
 }
 
 type UTxOut struct {
-	TxId   string `json:"txId"`
-	Index  int    `json:"index"`
-	Amount int    `json:"amount"`
+	TxId      string `json:"txId"`
+	Index     int    `json:"index"`
+	Address   string `json:"address"`
+	Amount    int    `json:"amount"`
+	WatchOnly bool   `json:"watchOnly,omitempty"`
 }
 
 type mempool struct {
@@ -60,6 +110,21 @@ type mempool struct {
 var m *mempool
 var minerReward int = 10
 
+// miningAddress receives block rewards instead of the wallet when set, so
+// they can go to keys the node doesn't hold.
+var miningAddress string
+
+func SetMiningAddress(address string) {
+	miningAddress = address
+}
+
+func payoutAddress() string {
+	if miningAddress != "" {
+		return miningAddress
+	}
+	return w.Wallet().Address
+}
+
 func Mempool() *mempool {
 	if m == nil {
 		m = &mempool{
@@ -79,12 +144,20 @@ func MemPoolTxs(m *mempool) []*Tx {
 	return txs
 }
 
+// calcId hashes the transaction without signatures and preimages, so
+// relaying it can't change the id.
 func (t *Tx) calcId() {
-	t.Id = utils.Hash(t)
+	data := txData{Timestamp: t.Timestamp, TxOuts: t.TxOuts}
+	for _, txIn := range t.TxIns {
+		stripped := stripWitness(txIn)
+		data.TxIns = append(data.TxIns, &stripped)
+	}
+	t.Id = utils.HashJson(data)
 }
 
-func (m *mempool) clear() {
-	m.Txs = make(map[string]*Tx)
+// calcWitnessHash hashes the whole transaction including its witness data.
+func (t *Tx) calcWitnessHash() {
+	t.WitnessHash = utils.HashJson(txData{t.Timestamp, t.TxIns, t.TxOuts})
 }
 
 func (m *mempool) removeTx(id string) {
@@ -106,64 +179,160 @@ func isOnMempool(uTxOut *UTxOut) bool {
 	return false
 }
 
-func getTxstoConfirm(b *blockchain) []*Tx {
+func getTxstoConfirm(b *blockchain, height int) []*Tx {
 	Mempool().m.Lock()
 	defer Mempool().m.Unlock()
 	var txs []*Tx
-	for _, tx := range Mempool().Txs {
-		if verifyTx(b, tx) {
-			txs = append(txs, tx)
+	var fees int
+	spent := make(map[string]bool)
+	for id, tx := range Mempool().Txs {
+		if !verifyTx(b, tx) {
+			delete(Mempool().Txs, id)
+			continue
+		}
+		if spendsAny(tx, spent) {
+			continue
+		}
+		txs = append(txs, tx)
+		fees += txFeePaid(b, tx)
+	}
+	return append(txs, makeCoinbaseTx(height, fees))
+}
+
+// spendsAny reports whether tx spends an outpoint in spent, and adds its
+// own inputs to spent when it doesn't.
+func spendsAny(tx *Tx, spent map[string]bool) bool {
+	for _, txIn := range tx.TxIns {
+		if spent[outpoint(txIn.TxId, txIn.Index)] {
+			return true
 		}
 	}
-	Mempool().clear()
-	return append(txs, makeCoinbaseTx())
+	for _, txIn := range tx.TxIns {
+		spent[outpoint(txIn.TxId, txIn.Index)] = true
+	}
+	return false
 }
 
-func makeCoinbaseTx() *Tx {
+func makeCoinbaseTx(height int, fees int) *Tx {
 	tx := &Tx{
 		Id:        "",
 		Timestamp: int(time.Now().Unix()),
 		TxIns: []*TxIn{{
-			Address: "Coinbase",
-			TxId:    "",
-			Index:   -1,
+			Address:  "Coinbase",
+			TxId:     "",
+			Index:    -1,
+			Coinbase: fmt.Sprint(height),
 		}},
 		TxOuts: []*TxOut{{
-			Address: w.Wallet().Address,
-			Amount:  minerReward,
+			Address: payoutAddress(),
+			Amount:  minerReward + fees,
 		}},
 	}
 	tx.calcId()
+	tx.calcWitnessHash()
 
 	return tx
 }
 
-func (m *mempool) AddTx(b *blockchain, to string, amount int) (*Tx, error) {
-	tx, err := makeTx(b, to, amount)
+// AddTx pays outs with coins of wl.
+func (m *mempool) AddTx(b *blockchain, wl *wallet.W, outs []*TxOut, strategy string) (*Tx, error) {
+	tx, err := makeTx(b, wl, outs, strategy)
 	if err != nil {
 		return nil, err
 	}
+	m.addTx(tx)
+	return tx, nil
+}
 
+func (m *mempool) addTx(tx *Tx) {
 	m.m.Lock()
 	defer m.m.Unlock()
 	m.Txs[tx.Id] = tx
-	return tx, nil
+	notifyChange()
+}
+
+// AddPeerTx puts a transaction relayed by a peer on the mempool after the
+// checks SubmitTx makes.
+func (m *mempool) AddPeerTx(b *blockchain, tx *Tx) error {
+	_, err := m.SubmitTx(b, tx)
+	return err
+}
+
+// FeeEstimate is what paying outs would cost with the chosen inputs.
+type FeeEstimate struct {
+	Fee    int `json:"fee"`
+	Inputs int `json:"inputs"`
+	Change int `json:"change"`
+}
+
+func validateOuts(outs []*TxOut) error {
+	if len(outs) == 0 {
+		return errors.New("No outputs to pay")
+	}
+	for _, out := range outs {
+		if out.isData() {
+			if err := validateData(out); err != nil {
+				return err
+			}
+			continue
+		}
+		if out.Amount <= 0 {
+			return errors.New("Amount should be positive")
+		}
+		if out.Address == "" && out.HTLC == nil {
+			return errors.New("Output needs an address")
+		}
+	}
+	return validateAddresses(outs)
+}
+
+// validateAddresses checks the addresses outs pay, so no transaction we
+// make or take sends coins to a malformed address or another network's.
+func validateAddresses(outs []*TxOut) error {
+	for _, out := range outs {
+		if out.Address != "" {
+			if err := wallet.ValidateAddress(out.Address); err != nil {
+				return err
+			}
+		}
+		if out.HTLC != nil {
+			if err := wallet.ValidateAddress(out.HTLC.Recipient); err != nil {
+				return err
+			}
+			if err := wallet.ValidateAddress(out.HTLC.Refund); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
-func makeTx(b *blockchain, to string, amount int) (*Tx, error) {
-	if GetBalanceByAddr(b, w.Wallet().Address) < amount {
-		return nil, errors.New("Not enough balance")
+// fundOuts selects coins of wl paying outs and their fee and puts a change
+// output in front of outs when the leftover is worth it. The change output
+// has no address yet, makeTx gives it a fresh one.
+func fundOuts(b *blockchain, wl *wallet.W, outs []*TxOut, strategy string) ([]*TxIn, []*TxOut, *FeeEstimate, error) {
+	err := validateOuts(outs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	selector, err := getCoinSelector(strategy)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var amount int
+	for _, out := range outs {
+		amount += out.Amount
+	}
+	coins := selector.selectCoins(spendableUTxOuts(b, wl), amount+txFee(0, len(outs)))
+	if coins == nil {
+		return nil, nil, nil, errors.New("Not enough balance")
 	}
 
 	txIns := []*TxIn{}
 	var total int
-	uTxOuts := GetUTxOutsByAddr(b, w.Wallet().Address)
-	for _, uTxOut := range uTxOuts {
-		if total >= amount {
-			break
-		}
+	for _, uTxOut := range coins {
 		txIn := TxIn{
-			Address: w.Wallet().Address,
+			Address: uTxOut.Address,
 			TxId:    uTxOut.TxId,
 			Index:   uTxOut.Index,
 		}
@@ -172,19 +341,38 @@ func makeTx(b *blockchain, to string, amount int) (*Tx, error) {
 	}
 
 	txOuts := []*TxOut{}
-	change := total - amount
-	if change > 0 {
+	estimate := &FeeEstimate{Inputs: len(txIns)}
+	change := total - amount - txFee(len(txIns), len(outs))
+	if change > costOfChange {
+		estimate.Change = change - feePerOutput
 		txOut := TxOut{
-			Address: w.Wallet().Address,
-			Amount:  change,
+			Amount: estimate.Change,
 		}
 		txOuts = append(txOuts, &txOut)
 	}
-	txOut := TxOut{
-		Address: to,
-		Amount:  amount,
+	txOuts = append(txOuts, outs...)
+	estimate.Fee = total - amount - estimate.Change
+	return txIns, txOuts, estimate, nil
+}
+
+func EstimateFee(b *blockchain, wl *wallet.W, outs []*TxOut, strategy string) (*FeeEstimate, error) {
+	_, _, estimate, err := fundOuts(b, wl, outs, strategy)
+	return estimate, err
+}
+
+func makeTx(b *blockchain, wl *wallet.W, outs []*TxOut, strategy string) (*Tx, error) {
+	txIns, txOuts, estimate, err := fundOuts(b, wl, outs, strategy)
+	if err != nil {
+		return nil, err
+	}
+	var change string
+	if estimate.Change > 0 {
+		change, err = w.ChangeAddress(wl)
+		if err != nil {
+			return nil, err
+		}
+		txOuts[0].Address = change
 	}
-	txOuts = append(txOuts, &txOut)
 
 	tx := Tx{
 		Id:        "",
@@ -193,70 +381,192 @@ func makeTx(b *blockchain, to string, amount int) (*Tx, error) {
 		TxOuts:    txOuts,
 	}
 	tx.calcId()
-	tx.sign()
+	err = tx.sign(b, wl, SigHashAll)
+	if err != nil {
+		if change != "" {
+			w.ReleaseChange(wl, change)
+		}
+		return nil, err
+	}
+	if change != "" {
+		w.ClaimChange(wl, change)
+	}
+	tx.calcWitnessHash()
 	return &tx, nil
 }
 
-func findTx(b *blockchain, id string) *Tx {
-	blocks := Blocks(b)
-	for _, block := range blocks {
-		for _, tx := range block.Transactions {
-			if tx.Id == id {
-				return tx
-			}
+// findTxOut returns the unspent output txIn spends.
+func findTxOut(b *blockchain, txIn *TxIn) *TxOut {
+	return findUTxOut(txIn.TxId, txIn.Index)
+}
+
+// sign signs every input that spends an output owned by wl, leaving inputs
+// of other parties untouched.
+func (t *Tx) sign(b *blockchain, wl *wallet.W, sigHash int) error {
+	height := GetHeight(b) + 1
+	for index, txIn := range t.TxIns {
+		spent := findTxOut(b, txIn)
+		if spent == nil {
+			return errors.New("Spent output not found")
+		}
+		owner, ok := spent.spender(txIn, height)
+		if !ok || !w.Owns(wl, owner) {
+			continue
+		}
+		digest, err := t.sigHash(index, spent, sigHash)
+		if err != nil {
+			return err
+		}
+		signature, err := w.Sign(digest, wl, owner)
+		if err != nil {
+			return err
+		}
+		pubKey, err := w.PublicKey(wl, owner)
+		if err != nil {
+			return err
 		}
+		txIn.SigHash = sigHash
+		txIn.Signature = signature
+		txIn.PubKey = pubKey
 	}
 	return nil
 }
 
-func (t *Tx) sign() {
-	for _, txIn := range t.TxIns {
-		txIn.Signature = w.Sign(t.Id, w.Wallet())
-	}
+func verifyTx(b *blockchain, t *Tx) bool {
+	_, ok := checkTx(t, GetHeight(b)+1, func(txIn *TxIn) *TxOut {
+		return findTxOut(b, txIn)
+	}, true)
+	return ok
 }
 
-func verifyTx(b *blockchain, t *Tx) bool {
-	for _, txIn := range t.TxIns {
-		txOut := findTx(b, txIn.TxId).TxOuts[txIn.Index]
-		ok := w.Verify(txOut.Address, t.Id, txIn.Signature)
+// checkTx verifies a transaction going into a block at height, finding the
+// outputs it spends with lookup, and returns the fee it pays. Signatures
+// are only checked with checkSigs.
+func checkTx(t *Tx, height int, lookup func(txIn *TxIn) *TxOut, checkSigs bool) (int, bool) {
+	if validateAddresses(t.TxOuts) != nil {
+		return 0, false
+	}
+	var total int
+	seen := make(map[string]bool)
+	for index, txIn := range t.TxIns {
+		key := outpoint(txIn.TxId, txIn.Index)
+		if seen[key] {
+			return 0, false
+		}
+		seen[key] = true
+		spent := lookup(txIn)
+		if spent == nil {
+			return 0, false
+		}
+		total += spent.Amount
+		owner, ok := spent.spender(txIn, height)
 		if !ok {
-			return false
+			return 0, false
+		}
+		if !checkSigs {
+			continue
+		}
+		digest, err := t.sigHash(index, spent, txIn.SigHash)
+		if err != nil {
+			return 0, false
+		}
+		if !w.Verify(owner, txIn.PubKey, digest, txIn.Signature) {
+			return 0, false
 		}
 	}
-	return true
+	for _, txOut := range t.TxOuts {
+		if txOut.Amount < 0 {
+			return 0, false
+		}
+		if txOut.isData() && validateData(txOut) != nil {
+			return 0, false
+		}
+		total -= txOut.Amount
+	}
+	return total, total >= 0
 }
 
-func GetUTxOutsByAddr(b *blockchain, address string) []*UTxOut {
-	var uTxOuts []*UTxOut
-	txUsedMap := make(map[string]bool)
-	for _, block := range Blocks(b) {
-		for _, tx := range block.Transactions {
-			for _, txIn := range tx.TxIns {
-				if txIn.Address == address {
-					txUsedMap[txIn.TxId] = true
-				}
-			}
-			for index, txOut := range tx.TxOuts {
-				if txOut.Address == address {
-					if _, ok := txUsedMap[tx.Id]; !ok {
-						uTxOut := &UTxOut{
-							TxId:   tx.Id,
-							Index:  index,
-							Amount: txOut.Amount,
-						}
-						if !isOnMempool(uTxOut) {
-							uTxOuts = append(uTxOuts, uTxOut)
-						}
-					}
-				}
-			}
+// txFeePaid is what the inputs of a verified transaction leave over its
+// outputs.
+func txFeePaid(b *blockchain, t *Tx) int {
+	var fee int
+	for _, txIn := range t.TxIns {
+		fee += findTxOut(b, txIn).Amount
+	}
+	for _, txOut := range t.TxOuts {
+		fee -= txOut.Amount
+	}
+	return fee
+}
+
+// SignTx adds the signatures of wl to a transaction built by several
+// parties, committing to the parts of it selected by sigHash.
+func SignTx(b *blockchain, wl *wallet.W, tx *Tx, sigHash int) (*Tx, error) {
+	err := validateAddresses(tx.TxOuts)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.sign(b, wl, sigHash)
+	if err != nil {
+		return nil, err
+	}
+	tx.calcId()
+	tx.calcWitnessHash()
+	return tx, nil
+}
+
+// SubmitTx puts a fully signed transaction on the mempool.
+func (m *mempool) SubmitTx(b *blockchain, tx *Tx) (*Tx, error) {
+	if len(tx.TxIns) == 0 || len(tx.TxOuts) == 0 {
+		return nil, errors.New("Transaction needs inputs and outputs")
+	}
+	if err := validateAddresses(tx.TxOuts); err != nil {
+		return nil, err
+	}
+	for _, txIn := range tx.TxIns {
+		if isOnMempool(&UTxOut{TxId: txIn.TxId, Index: txIn.Index}) {
+			return nil, errors.New("Output is already spent on mempool")
 		}
 	}
-	return uTxOuts
+	if !verifyTx(b, tx) {
+		return nil, errors.New("Invalid transaction")
+	}
+	tx.calcId()
+	tx.calcWitnessHash()
+	m.addTx(tx)
+	return tx, nil
+}
+
+// spender returns the address whose signature unlocks the output when it
+// is spent by txIn in a block at the given height.
+func (o *TxOut) spender(txIn *TxIn, height int) (string, bool) {
+	if o.isData() {
+		return "", false
+	}
+	if o.HTLC == nil {
+		return o.Address, true
+	}
+	return o.HTLC.spender(txIn.Preimage, height)
 }
 
 func GetBalanceByAddr(b *blockchain, address string) int {
-	uTxOuts := GetUTxOutsByAddr(b, address)
+	return sumUTxOuts(GetUTxOutsByAddr(b, address))
+}
+
+// GetWalletBalance sums the coins wl can spend and those it only watches.
+func GetWalletBalance(b *blockchain, wl *wallet.W) (int, int) {
+	var spendable, watchOnly int
+	for _, uTxOut := range GetWalletUTxOuts(b, wl) {
+		if uTxOut.WatchOnly {
+			watchOnly += uTxOut.Amount
+		} else {
+			spendable += uTxOut.Amount
+		}
+	}
+	return spendable, watchOnly
+}
+
+func sumUTxOuts(uTxOuts []*UTxOut) int {
 	var total int
 	for _, txOut := range uTxOuts {
 		total += txOut.Amount
@@ -0,0 +1,174 @@
+package blockchain
+
+import "testing"
+
+func TestCalcId(t *testing.T) {
+	newTx := func(signature string) *Tx {
+		return &Tx{
+			Timestamp: 1,
+			TxIns:     []*TxIn{{Address: "from", TxId: "txId", Index: 0, Signature: signature, SigHash: SigHashAll}},
+			TxOuts:    []*TxOut{{Address: "to", Amount: 1}},
+		}
+	}
+	tx1, tx2 := newTx("signature1"), newTx("signature2")
+	tx1.calcId()
+	tx2.calcId()
+	tx1.calcWitnessHash()
+	tx2.calcWitnessHash()
+
+	t.Run("should not depend on signatures", func(t *testing.T) {
+		if tx1.Id != tx2.Id {
+			t.Errorf("ids should match, Id1: %s, Id2: %s", tx1.Id, tx2.Id)
+		}
+	})
+	t.Run("witness hash should depend on signatures", func(t *testing.T) {
+		if tx1.WitnessHash == tx2.WitnessHash {
+			t.Error("witness hashes should differ")
+		}
+	})
+	t.Run("should not depend on public keys", func(t *testing.T) {
+		tx3 := newTx("signature1")
+		tx3.TxIns[0].PubKey = "pubKey"
+		tx3.calcId()
+		if tx3.Id != tx1.Id {
+			t.Errorf("ids should match, Id1: %s, Id3: %s", tx1.Id, tx3.Id)
+		}
+	})
+}
+
+// testAddress is a well formed address of the main network.
+var testAddress = networks["main"].GenesisAddress
+
+func TestValidateOuts(t *testing.T) {
+	t.Run("should accept a list of payments", func(t *testing.T) {
+		err := validateOuts([]*TxOut{{Address: testAddress, Amount: 1}, {Address: testAddress, Amount: 2}})
+		if err != nil {
+			t.Errorf("Expected: nil, Got: %v", err)
+		}
+	})
+	t.Run("should reject an empty list", func(t *testing.T) {
+		if err := validateOuts(nil); err == nil {
+			t.Error("should return an error")
+		}
+	})
+	t.Run("should reject the whole batch for one bad output", func(t *testing.T) {
+		err := validateOuts([]*TxOut{{Address: testAddress, Amount: 1}, {Address: testAddress, Amount: 0}})
+		if err == nil {
+			t.Error("should return an error")
+		}
+	})
+	t.Run("should reject an output without address", func(t *testing.T) {
+		if err := validateOuts([]*TxOut{{Amount: 1}}); err == nil {
+			t.Error("should return an error")
+		}
+	})
+	t.Run("should reject a malformed address", func(t *testing.T) {
+		if err := validateOuts([]*TxOut{{Address: "to", Amount: 1}}); err == nil {
+			t.Error("should return an error")
+		}
+	})
+	t.Run("should reject a malformed HTLC refund address", func(t *testing.T) {
+		htlc := &HTLC{Recipient: testAddress, Refund: "refund"}
+		if err := validateOuts([]*TxOut{{Amount: 1, HTLC: htlc}}); err == nil {
+			t.Error("should return an error")
+		}
+	})
+}
+
+func TestPayoutAddress(t *testing.T) {
+	w = testWallet{}
+	defer SetMiningAddress("")
+	t.Run("should pay the wallet by default", func(t *testing.T) {
+		if address := makeCoinbaseTx(1, 0).TxOuts[0].Address; address != "" {
+			t.Errorf("Expected the wallet address, Got: %s", address)
+		}
+	})
+	t.Run("should pay the mining address when set", func(t *testing.T) {
+		SetMiningAddress("cold")
+		if address := makeCoinbaseTx(1, 0).TxOuts[0].Address; address != "cold" {
+			t.Errorf("Expected: cold, Got: %s", address)
+		}
+	})
+}
+
+func TestSubmitTx(t *testing.T) {
+	defer withParams(&chainParams{ChainId: "test", Checkpoints: map[int]string{}})()
+	defer func() { storage = testStorage{} }()
+
+	t.Run("should reject an output spent twice", func(t *testing.T) {
+		_, chain := storeTestChain()
+		paid := chain[1].Transactions[0]
+		txIn := func() *TxIn {
+			return &TxIn{TxId: paid.Id, Index: 0, SigHash: SigHashAll, Signature: "signature"}
+		}
+		tx := &Tx{
+			Timestamp: 1,
+			TxIns:     []*TxIn{txIn(), txIn()},
+			TxOuts:    []*TxOut{{Address: testAddress, Amount: 2 * paid.TxOuts[0].Amount}},
+		}
+		_, err := Mempool().SubmitTx(&blockchain{LastHash: chain[1].Hash}, tx)
+		if err == nil {
+			t.Error("should return an error")
+		}
+		if _, ok := Mempool().Txs[tx.Id]; ok {
+			t.Error("should not be on the mempool")
+		}
+	})
+	t.Run("should reject a malformed address", func(t *testing.T) {
+		_, chain := storeTestChain()
+		paid := chain[1].Transactions[0]
+		tx := &Tx{
+			Timestamp: 1,
+			TxIns:     []*TxIn{{TxId: paid.Id, Index: 0, SigHash: SigHashAll, Signature: "signature"}},
+			TxOuts:    []*TxOut{{Address: "to", Amount: paid.TxOuts[0].Amount}},
+		}
+		if _, err := Mempool().SubmitTx(&blockchain{LastHash: chain[1].Hash}, tx); err == nil {
+			t.Error("should return an error")
+		}
+		lookup := func(txIn *TxIn) *TxOut { return paid.TxOuts[0] }
+		if _, ok := checkTx(tx, 3, lookup, false); ok {
+			t.Error("should not be valid in a block")
+		}
+	})
+}
+
+func TestAddPeerTx(t *testing.T) {
+	defer withParams(&chainParams{ChainId: "test", Checkpoints: map[int]string{}})()
+	defer func() { storage = testStorage{} }()
+
+	_, chain := storeTestChain()
+	tip := &blockchain{LastHash: chain[1].Hash}
+	paid := chain[1].Transactions[0]
+	newTx := func() *Tx {
+		return &Tx{
+			Id:        "peerId",
+			Timestamp: 1,
+			TxIns:     []*TxIn{{TxId: paid.Id, Index: 0, SigHash: SigHashAll, Signature: "signature"}},
+			TxOuts:    []*TxOut{{Address: testAddress, Amount: paid.TxOuts[0].Amount}},
+		}
+	}
+
+	t.Run("should reject an invalid signature", func(t *testing.T) {
+		w = rejectingWallet{}
+		defer func() { w = testWallet{} }()
+		if err := Mempool().AddPeerTx(tip, newTx()); err == nil {
+			t.Error("should return an error")
+		}
+		if _, ok := Mempool().Txs["peerId"]; ok {
+			t.Error("should not be on the mempool")
+		}
+	})
+	t.Run("should store a valid transaction under its own id", func(t *testing.T) {
+		tx := newTx()
+		defer Mempool().removeTx(tx.Id)
+		if err := Mempool().AddPeerTx(tip, tx); err != nil {
+			t.Fatalf("Expected: nil, Got: %v", err)
+		}
+		if _, ok := Mempool().Txs["peerId"]; ok || tx.Id == "peerId" {
+			t.Error("should not keep the id the peer sent")
+		}
+		if err := Mempool().AddPeerTx(tip, newTx()); err == nil {
+			t.Error("should not let a peer replace a mempool entry")
+		}
+	})
+}
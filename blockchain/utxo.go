@@ -0,0 +1,112 @@
+package blockchain
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fantasticake/simple-coin/utils"
+	"github.com/fantasticake/simple-coin/wallet"
+)
+
+// spentOutput is the undo data of a block: an output it spent, so the
+// block can be disconnected without looking up older blocks.
+type spentOutput struct {
+	Outpoint string
+	TxOut    *TxOut
+}
+
+func outpoint(txId string, index int) string {
+	return txId + ":" + strconv.Itoa(index)
+}
+
+func parseOutpoint(key string) (string, int) {
+	sep := strings.LastIndex(key, ":")
+	index, err := strconv.Atoi(key[sep+1:])
+	utils.HandleErr(err)
+	return key[:sep], index
+}
+
+func findUTxOut(txId string, index int) *TxOut {
+	data, err := storage.FindUTxOut([]byte(outpoint(txId, index)))
+	if err != nil {
+		return nil
+	}
+	txOut := &TxOut{}
+	utils.FromBytes(txOut, data)
+	return txOut
+}
+
+// utxoChanges returns the undo data of a block along with the outpoints it
+// spends and the outputs it creates.
+func utxoChanges(block *Block) ([]spentOutput, [][]byte, map[string][]byte) {
+	undo := []spentOutput{}
+	var spent [][]byte
+	created := make(map[string][]byte)
+	for _, tx := range block.Transactions {
+		if !isCoinbase(tx) {
+			for _, txIn := range tx.TxIns {
+				key := outpoint(txIn.TxId, txIn.Index)
+				if txOut := findUTxOut(txIn.TxId, txIn.Index); txOut != nil {
+					undo = append(undo, spentOutput{key, txOut})
+				}
+				spent = append(spent, []byte(key))
+			}
+		}
+		for index, txOut := range tx.TxOuts {
+			if !txOut.isData() {
+				created[outpoint(tx.Id, index)] = utils.ToBytes(txOut)
+			}
+		}
+	}
+	return undo, spent, created
+}
+
+func GetUTxOutsByAddr(b *blockchain, address string) []*UTxOut {
+	return getUTxOuts(func(owner string) bool { return owner == address })
+}
+
+// GetWalletUTxOuts returns the coins of every address wl watches, flagging
+// the ones it can't spend.
+func GetWalletUTxOuts(b *blockchain, wl *wallet.W) []*UTxOut {
+	uTxOuts := getUTxOuts(func(owner string) bool { return w.Watches(wl, owner) })
+	for _, uTxOut := range uTxOuts {
+		uTxOut.WatchOnly = !w.Owns(wl, uTxOut.Address)
+	}
+	return uTxOuts
+}
+
+// spendableUTxOuts returns the coins wl can spend.
+func spendableUTxOuts(b *blockchain, wl *wallet.W) []*UTxOut {
+	return getUTxOuts(func(owner string) bool { return w.Owns(wl, owner) })
+}
+
+// getUTxOuts returns the spendable outputs whose address owns accepts,
+// leaving out the ones spent on the mempool.
+func getUTxOuts(owns func(address string) bool) []*UTxOut {
+	var uTxOuts []*UTxOut
+	storage.ForEachUTxOut(func(key []byte, data []byte) {
+		txOut := &TxOut{}
+		utils.FromBytes(txOut, data)
+		if txOut.Address == "" || txOut.isData() || !owns(txOut.Address) {
+			return
+		}
+		txId, index := parseOutpoint(string(key))
+		uTxOut := &UTxOut{
+			TxId:    txId,
+			Index:   index,
+			Address: txOut.Address,
+			Amount:  txOut.Amount,
+		}
+		if !isOnMempool(uTxOut) {
+			uTxOuts = append(uTxOuts, uTxOut)
+		}
+	})
+	sort.Slice(uTxOuts, func(i, j int) bool {
+		if uTxOuts[i].TxId != uTxOuts[j].TxId {
+			return uTxOuts[i].TxId < uTxOuts[j].TxId
+		}
+		return uTxOuts[i].Index < uTxOuts[j].Index
+	})
+	return uTxOuts
+}
@@ -0,0 +1,80 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/fantasticake/simple-coin/utils"
+	"github.com/fantasticake/simple-coin/wallet"
+)
+
+func TestUtxoChanges(t *testing.T) {
+	defer func() { storage = testStorage{} }()
+	storage = testStorage{
+		fakeFindUTxOut: func(key []byte) ([]byte, error) {
+			return utils.ToBytes(&TxOut{Address: "from", Amount: 5}), nil
+		},
+	}
+	tx := &Tx{
+		Id:     "txId",
+		TxIns:  []*TxIn{{TxId: "prevId", Index: 1}},
+		TxOuts: []*TxOut{{Address: "to", Amount: 4}, {Data: "cafe"}},
+	}
+	coinbase := &Tx{Id: "coinbaseId", TxIns: []*TxIn{{Index: -1}}, TxOuts: []*TxOut{{Address: "miner", Amount: 11}}}
+	undo, spent, created := utxoChanges(&Block{Transactions: []*Tx{tx, coinbase}})
+
+	if len(undo) != 1 || undo[0].Outpoint != "prevId:1" || undo[0].TxOut.Amount != 5 {
+		t.Errorf("Expected undo of prevId:1, Got: %v", undo)
+	}
+	if len(spent) != 1 || string(spent[0]) != "prevId:1" {
+		t.Errorf("Expected spent: [prevId:1], Got: %s", spent)
+	}
+	if len(created) != 2 || created["txId:0"] == nil || created["coinbaseId:0"] == nil {
+		t.Errorf("Expected outputs txId:0 and coinbaseId:0, Got: %v", created)
+	}
+}
+
+func TestParseOutpoint(t *testing.T) {
+	txId, index := parseOutpoint(outpoint("a:b", 12))
+	if txId != "a:b" || index != 12 {
+		t.Errorf("Expected: a:b 12, Got: %s %d", txId, index)
+	}
+}
+
+// coldWallet spends the coins of "miner" and only watches those of toAddress.
+type coldWallet struct {
+	testWallet
+}
+
+func (coldWallet) Owns(w *wallet.W, address string) bool {
+	return address == "miner"
+}
+func (coldWallet) Watches(w *wallet.W, address string) bool {
+	return address == "miner" || address == toAddress
+}
+
+func TestGetWalletUTxOuts(t *testing.T) {
+	defer withParams(&chainParams{ChainId: "test", Checkpoints: map[int]string{}})()
+	defer func() { storage = testStorage{} }()
+	defer SetMiningAddress("")
+
+	SetMiningAddress("miner")
+	storeTestChain()
+	w = coldWallet{}
+	defer func() { w = testWallet{} }()
+
+	uTxOuts := GetWalletUTxOuts(BC(), w.Wallet())
+	if len(uTxOuts) != 2 {
+		t.Fatalf("Expected: 2 outputs, Got: %v", uTxOuts)
+	}
+	for _, uTxOut := range uTxOuts {
+		if uTxOut.WatchOnly != (uTxOut.Address == toAddress) {
+			t.Errorf("should flag only the watched output, Got: %v", uTxOut)
+		}
+	}
+	if spendable, watchOnly := GetWalletBalance(BC(), w.Wallet()); spendable == 0 || watchOnly != minerReward-1 {
+		t.Errorf("Expected: watch-only %d, Got: %d %d", minerReward-1, spendable, watchOnly)
+	}
+	if spendable := spendableUTxOuts(BC(), w.Wallet()); len(spendable) != 1 || spendable[0].Address != "miner" {
+		t.Errorf("should only spend the owned output, Got: %v", spendable)
+	}
+}
@@ -0,0 +1,158 @@
+package blockchain
+
+import "errors"
+
+var (
+	errBadLink       = errors.New("Block does not link to the previous block")
+	errBadDifficulty = errors.New("Block has a wrong difficulty")
+	errCheckpoint    = errors.New("Block conflicts with a checkpoint")
+	errBadCommitment = errors.New("Block hash or merkle roots are invalid")
+	errBadCoinbase   = errors.New("Block has an invalid coinbase")
+	errDoubleSpend   = errors.New("Block spends an output twice")
+	errBadTx         = errors.New("Block has an invalid transaction")
+)
+
+// utxoView tracks unspent outputs while a chain is validated from genesis.
+type utxoView map[string]*TxOut
+
+func (v utxoView) lookup(txIn *TxIn) *TxOut {
+	return v[outpoint(txIn.TxId, txIn.Index)]
+}
+
+func (v utxoView) apply(block *Block) {
+	for _, tx := range block.Transactions {
+		for _, txIn := range tx.TxIns {
+			delete(v, outpoint(txIn.TxId, txIn.Index))
+		}
+		for index, txOut := range tx.TxOuts {
+			if !txOut.isData() {
+				v[outpoint(tx.Id, index)] = txOut
+			}
+		}
+	}
+}
+
+// undo returns the outputs of the view that block spends.
+func (v utxoView) undo(block *Block) []spentOutput {
+	undo := []spentOutput{}
+	for _, tx := range block.Transactions {
+		if isCoinbase(tx) {
+			continue
+		}
+		for _, txIn := range tx.TxIns {
+			key := outpoint(txIn.TxId, txIn.Index)
+			undo = append(undo, spentOutput{key, v[key]})
+		}
+	}
+	return undo
+}
+
+func isCoinbase(tx *Tx) bool {
+	return len(tx.TxIns) == 1 && tx.TxIns[0].Index == -1
+}
+
+// expectedDifficulty is the difficulty of the block following chain, which
+// is ordered from genesis up.
+func expectedDifficulty(chain []*Block) int {
+	height := len(chain)
+	if height == 0 {
+		return defaultDifficulty
+	} else if height%recalcDiffInterval == 0 {
+		return adjustDifficulty(chain[height-1], chain[height-recalcDiffInterval])
+	}
+	return chain[height-1].Difficulty
+}
+
+// validateBlock checks a block on top of prev, which is nil for genesis.
+func validateBlock(block *Block, prev *Block, lookup func(txIn *TxIn) *TxOut, checkSigs bool) error {
+	if prev == nil {
+		if block.PrevHash != "" || block.Height != 1 {
+			return errBadLink
+		}
+	} else if block.PrevHash != prev.Hash || block.Height != prev.Height+1 {
+		return errBadLink
+	}
+	if hash, ok := params.Checkpoints[block.Height]; ok && hash != block.Hash {
+		return errCheckpoint
+	}
+	if !block.verifyCommitments() {
+		return errBadCommitment
+	}
+
+	last := len(block.Transactions) - 1
+	if last < 0 || !isCoinbase(block.Transactions[last]) {
+		return errBadCoinbase
+	}
+	spent := make(map[string]bool)
+	var fees int
+	for _, tx := range block.Transactions[:last] {
+		if isCoinbase(tx) {
+			return errBadCoinbase
+		}
+		for _, txIn := range tx.TxIns {
+			key := outpoint(txIn.TxId, txIn.Index)
+			if spent[key] {
+				return errDoubleSpend
+			}
+			spent[key] = true
+		}
+		fee, ok := checkTx(tx, block.Height, lookup, checkSigs)
+		if !ok {
+			return errBadTx
+		}
+		fees += fee
+	}
+	if block.CoinbaseValue() > minerReward+fees {
+		return errBadCoinbase
+	}
+	return nil
+}
+
+// validateChain checks blocks ordered from genesis up. Signatures of the
+// assume-valid block and its ancestors are skipped.
+func validateChain(chain []*Block) error {
+	_, err := replayChain(chain, assumeValidHeight(chain))
+	return err
+}
+
+// assumeValidHeight is the height of the assume-valid block among headers,
+// or 0 when they don't include it.
+func assumeValidHeight(headers []*Block) int {
+	for _, header := range headers {
+		if params.AssumeValid != "" && header.Hash == params.AssumeValid {
+			return header.Height
+		}
+	}
+	return 0
+}
+
+// replayChain validates chain from genesis up, skipping signatures up to
+// skipSigsUpTo, and returns the UTXO set it leaves.
+func replayChain(chain []*Block, skipSigsUpTo int) (utxoView, error) {
+	view, _, err := replayPrefix(chain, skipSigsUpTo)
+	if err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// replayPrefix is replayChain stopping at the first invalid block. It
+// returns the UTXO set of the blocks before it and how many they are.
+func replayPrefix(chain []*Block, skipSigsUpTo int) (utxoView, int, error) {
+	view := utxoView{}
+	for i, block := range chain {
+		var prev *Block
+		if i > 0 {
+			prev = chain[i-1]
+		}
+		if block.Difficulty != expectedDifficulty(chain[:i]) {
+			return view, i, errBadDifficulty
+		}
+		err := validateBlock(block, prev, view.lookup, block.Height > skipSigsUpTo)
+		if err != nil {
+			return view, i, err
+		}
+		view.apply(block)
+	}
+	return view, len(chain), nil
+}
@@ -0,0 +1,123 @@
+package blockchain
+
+import "testing"
+
+type rejectingWallet struct{ testWallet }
+
+func (rejectingWallet) Verify(addr string, pubKey string, hash string, signature string) bool {
+	return false
+}
+
+func mineTestBlock(prev *Block, fees int, txs ...*Tx) *Block {
+	block := &Block{Height: 1, Difficulty: defaultDifficulty}
+	if prev != nil {
+		block.PrevHash = prev.Hash
+		block.Height = prev.Height + 1
+	}
+	block.Transactions = append(txs, makeCoinbaseTx(block.Height, fees))
+	block.MerkleRoot, block.WitnessRoot = txRoots(block.Transactions)
+	block.Mine(nil)
+	return block
+}
+
+// toAddress is the well formed address testChain pays.
+var toAddress = "SPunp3rDMn1FUsBBR7gMEz3i9gywjLkcKw"
+
+// testChain returns a genesis block and a block spending its coinbase.
+func testChain() []*Block {
+	w = testWallet{}
+	genesis := mineTestBlock(nil, 0)
+	spend := &Tx{
+		Timestamp: 1,
+		TxIns:     []*TxIn{{TxId: genesis.Transactions[0].Id, Index: 0, SigHash: SigHashAll, Signature: "signature"}},
+		TxOuts:    []*TxOut{{Address: toAddress, Amount: minerReward - 1}},
+	}
+	spend.calcId()
+	spend.calcWitnessHash()
+	return []*Block{genesis, mineTestBlock(genesis, 1, spend)}
+}
+
+func withParams(p *chainParams) func() {
+	old := params
+	params = p
+	return func() { params = old }
+}
+
+func TestValidateChain(t *testing.T) {
+	defer withParams(&chainParams{ChainId: "test", Checkpoints: map[int]string{}})()
+
+	t.Run("should accept a valid chain", func(t *testing.T) {
+		if err := validateChain(testChain()); err != nil {
+			t.Errorf("Expected: nil, Got: %v", err)
+		}
+	})
+	t.Run("should reject a broken link", func(t *testing.T) {
+		chain := testChain()
+		if err := validateChain(chain[1:]); err != errBadLink {
+			t.Errorf("Expected: %v, Got: %v", errBadLink, err)
+		}
+	})
+	t.Run("should reject a chain conflicting with a checkpoint", func(t *testing.T) {
+		params.Checkpoints[2] = "otherHash"
+		defer delete(params.Checkpoints, 2)
+		if err := validateChain(testChain()); err != errCheckpoint {
+			t.Errorf("Expected: %v, Got: %v", errCheckpoint, err)
+		}
+	})
+	t.Run("should reject a coinbase paying too much", func(t *testing.T) {
+		w = testWallet{}
+		genesis := mineTestBlock(nil, 0)
+		genesis.SetCoinbaseOutputs([]*TxOut{{Address: "greedy", Amount: minerReward + 1}})
+		genesis.Mine(nil)
+		if err := validateChain([]*Block{genesis}); err != errBadCoinbase {
+			t.Errorf("Expected: %v, Got: %v", errBadCoinbase, err)
+		}
+	})
+	t.Run("should reject a double spend", func(t *testing.T) {
+		chain := testChain()
+		spend := chain[1].Transactions[0]
+		third := mineTestBlock(chain[1], 1, spend)
+		if err := validateChain(append(chain, third)); err != errBadTx {
+			t.Errorf("Expected: %v, Got: %v", errBadTx, err)
+		}
+	})
+}
+
+func TestAssumeValid(t *testing.T) {
+	defer withParams(&chainParams{ChainId: "test", Checkpoints: map[int]string{}})()
+	chain := testChain()
+	w = rejectingWallet{}
+	defer func() { w = testWallet{} }()
+
+	t.Run("should check signatures by default", func(t *testing.T) {
+		if err := validateChain(chain); err != errBadTx {
+			t.Errorf("Expected: %v, Got: %v", errBadTx, err)
+		}
+	})
+	t.Run("should skip signatures below the assume-valid block", func(t *testing.T) {
+		params.AssumeValid = chain[1].Hash
+		if err := validateChain(chain); err != nil {
+			t.Errorf("Expected: nil, Got: %v", err)
+		}
+	})
+}
+
+func TestGenesisBlock(t *testing.T) {
+	hashes := map[string]string{
+		"main": "00944da845094860ea47deaa88ae209add4b6314c93bd2962e7029080ccfcdb3",
+		"test": "003766a8fe47efe5c28aac2c741f68c7bdec00bdbb9fe5272a58d22c2f5be428",
+	}
+	for name, network := range networks {
+		genesis := genesisBlock(network)
+		if genesis.Hash != hashes[name] {
+			t.Errorf("%s: Expected: %s, Got: %s", name, hashes[name], genesis.Hash)
+		}
+		old := params
+		params = network
+		err := validateChain([]*Block{genesis})
+		params = old
+		if err != nil {
+			t.Errorf("%s: Expected: nil, Got: %v", name, err)
+		}
+	}
+}
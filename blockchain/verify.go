@@ -0,0 +1,287 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/fantasticake/simple-coin/utils"
+)
+
+// Check levels of VerifyChain, each one including the previous ones.
+const (
+	CheckHeaders  = iota // linkage, proof of work and difficulty
+	CheckBodies          // block bodies and their merkle roots
+	CheckUndo            // undo data of every block
+	CheckUTXO            // transactions replayed from genesis against the UTXO set
+	MaxCheckLevel = CheckUTXO
+)
+
+var (
+	errNoChain      = errors.New("No blockchain stored")
+	errBadLevel     = errors.New("Unknown check level")
+	errPrunedChain  = errors.New("Blocks were pruned")
+	errBadUndo      = errors.New("Undo data does not match the block")
+	errUTXOMismatch = errors.New("UTXO set does not match the chain")
+	errCorruptData  = errors.New("Stored data does not decode")
+)
+
+// storedChain returns the blockchain saved in storage without creating a
+// genesis block like BC does.
+func storedChain() (*blockchain, error) {
+	blockchainAsB := storage.GetBlockchain()
+	if blockchainAsB == nil {
+		return nil, errNoChain
+	}
+	stored := &blockchain{}
+	if utils.DecodeBytes(stored, blockchainAsB) != nil {
+		return nil, errCorruptData
+	}
+	if stored.LastHash == "" {
+		return nil, errNoChain
+	}
+	return stored, nil
+}
+
+// storedHeaders returns the headers from genesis up to the stored tip.
+func storedHeaders(tip string) ([]*Block, error) {
+	var headers []*Block
+	for hashCursor := tip; hashCursor != ""; {
+		header, err := findHeader(hashCursor)
+		if err != nil {
+			return nil, fmt.Errorf("Header %s: %w", hashCursor, err)
+		}
+		headers = append(headers, header)
+		hashCursor = header.PrevHash
+	}
+	for i, j := 0, len(headers)-1; i < j; i, j = i+1, j-1 {
+		headers[i], headers[j] = headers[j], headers[i]
+	}
+	return headers, nil
+}
+
+// VerifyChain checks the stored chain from the tip down at the given level.
+// depth limits the checks to the most recent blocks, 0 checks all of them.
+// It returns how many blocks were checked.
+func VerifyChain(level int, depth int) (int, error) {
+	if level < CheckHeaders || level > MaxCheckLevel {
+		return 0, errBadLevel
+	}
+	stored, err := storedChain()
+	if err != nil {
+		return 0, err
+	}
+	headers, err := storedHeaders(stored.LastHash)
+	if err != nil {
+		return 0, err
+	}
+	from := 0
+	if depth > 0 && depth < len(headers) {
+		from = len(headers) - depth
+	}
+	if level >= CheckBodies && headers[from].Height <= stored.PrunedHeight {
+		return 0, errPrunedChain
+	}
+
+	for i := from; i < len(headers); i++ {
+		header := headers[i]
+		var prev *Block
+		if i > 0 {
+			prev = headers[i-1]
+		}
+		if err := verifyHeader(header, prev, headers[:i]); err != nil {
+			return 0, fmt.Errorf("Block %d: %w", header.Height, err)
+		}
+		if level < CheckBodies {
+			continue
+		}
+		block, err := FindBlock(header.Hash)
+		if err != nil {
+			return 0, fmt.Errorf("Block %d: %w", header.Height, err)
+		}
+		if !block.verifyCommitments() {
+			return 0, fmt.Errorf("Block %d: %w", header.Height, errBadCommitment)
+		}
+		if level < CheckUndo {
+			continue
+		}
+		if err := verifyUndo(block); err != nil {
+			return 0, fmt.Errorf("Block %d: %w", header.Height, err)
+		}
+	}
+
+	if level >= CheckUTXO {
+		if err := verifyUTXO(headers, stored.PrunedHeight, headers[from].Height-1); err != nil {
+			return 0, err
+		}
+	}
+	return len(headers) - from, nil
+}
+
+func verifyHeader(header *Block, prev *Block, ancestors []*Block) error {
+	if prev == nil {
+		if header.PrevHash != "" || header.Height != 1 {
+			return errBadLink
+		}
+	} else if header.PrevHash != prev.Hash || header.Height != prev.Height+1 {
+		return errBadLink
+	}
+	if hash, ok := params.Checkpoints[header.Height]; ok && hash != header.Hash {
+		return errCheckpoint
+	}
+	if header.Hash != header.calcHash() || !header.meetsDifficulty() {
+		return errBadCommitment
+	}
+	if header.Difficulty != expectedDifficulty(ancestors) {
+		return errBadDifficulty
+	}
+	return nil
+}
+
+// verifyUndo checks that the undo data lists every output the block spends.
+func verifyUndo(block *Block) error {
+	undoAsB, err := storage.FindUndo([]byte(block.Hash))
+	if err != nil {
+		return err
+	}
+	var undo []spentOutput
+	if utils.DecodeBytes(&undo, undoAsB) != nil {
+		return errBadUndo
+	}
+	var spent []string
+	for _, tx := range block.Transactions {
+		if isCoinbase(tx) {
+			continue
+		}
+		for _, txIn := range tx.TxIns {
+			spent = append(spent, outpoint(txIn.TxId, txIn.Index))
+		}
+	}
+	if len(undo) != len(spent) {
+		return errBadUndo
+	}
+	for i, entry := range undo {
+		if entry.Outpoint != spent[i] || entry.TxOut == nil {
+			return errBadUndo
+		}
+	}
+	return nil
+}
+
+// verifyUTXO replays every block from genesis, checking signatures above
+// skipSigsUpTo, and compares the outputs left with the stored UTXO set.
+func verifyUTXO(headers []*Block, prunedHeight int, skipSigsUpTo int) error {
+	if prunedHeight > 0 {
+		return errPrunedChain
+	}
+	chain := make([]*Block, len(headers))
+	for i, header := range headers {
+		block, err := FindBlock(header.Hash)
+		if err != nil {
+			return fmt.Errorf("Block %d: %w", header.Height, err)
+		}
+		chain[i] = block
+	}
+	view, err := replayChain(chain, skipSigsUpTo)
+	if err != nil {
+		return err
+	}
+	// Gob bytes are not canonical, so the decoded outputs are compared.
+	stored := utxoView{}
+	corrupt := false
+	storage.ForEachUTxOut(func(key []byte, data []byte) {
+		txOut := &TxOut{}
+		if utils.DecodeBytes(txOut, data) != nil {
+			corrupt = true
+			return
+		}
+		stored[string(key)] = txOut
+	})
+	if corrupt || !reflect.DeepEqual(stored, view) {
+		return errUTXOMismatch
+	}
+	return nil
+}
+
+// Reindex rebuilds the tip, headers, undo data and UTXO set from the stored
+// block bodies, keeping the longest valid chain. Bodies that don't decode
+// are skipped, and a chain with an invalid block is cut below it. It
+// returns the new height.
+func Reindex() (int, error) {
+	// The rest of the stored blockchain is kept, only the tip is rebuilt.
+	rebuilt, err := storedChain()
+	if err != nil {
+		rebuilt = &blockchain{}
+	} else if rebuilt.PrunedHeight > 0 {
+		return 0, errPrunedChain
+	}
+	blocks := make(map[string]*Block)
+	storage.ForEachBlock(func(key []byte, data []byte) {
+		block := &Block{}
+		if utils.DecodeBytes(block, data) == nil {
+			blocks[string(key)] = block
+		}
+	})
+	var chain []*Block
+	var firstErr error
+	for _, candidate := range linkedChains(blocks) {
+		if len(candidate) <= len(chain) {
+			break
+		}
+		_, valid, err := replayPrefix(candidate, assumeValidHeight(candidate))
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if valid > len(chain) {
+			chain = candidate[:valid]
+		}
+	}
+	if len(chain) == 0 {
+		if firstErr != nil {
+			return 0, firstErr
+		}
+		return 0, errNoChain
+	}
+
+	storage.ClearIndexes()
+	for _, block := range chain {
+		persistBlock(block)
+	}
+	rebuilt.LastHash = chain[len(chain)-1].Hash
+	PersistBlockchain(rebuilt)
+	return len(chain), nil
+}
+
+// linkedChains returns the chains of blocks linked down to genesis, each
+// ordered from genesis up, the longest first.
+func linkedChains(blocks map[string]*Block) [][]*Block {
+	var tips []*Block
+	for hash, block := range blocks {
+		if hash == block.Hash && block.Height > 0 {
+			tips = append(tips, block)
+		}
+	}
+	sort.Slice(tips, func(i, j int) bool {
+		if tips[i].Height != tips[j].Height {
+			return tips[i].Height > tips[j].Height
+		}
+		return tips[i].Hash < tips[j].Hash
+	})
+	var chains [][]*Block
+	for _, tip := range tips {
+		chain := make([]*Block, tip.Height)
+		block := tip
+		for i := tip.Height - 1; i >= 0; i-- {
+			if block == nil || block.Height != i+1 {
+				break
+			}
+			chain[i] = block
+			block = blocks[block.PrevHash]
+		}
+		if chain[0] != nil && chain[0].PrevHash == "" {
+			chains = append(chains, chain)
+		}
+	}
+	return chains
+}
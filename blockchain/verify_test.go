@@ -0,0 +1,222 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fantasticake/simple-coin/utils"
+)
+
+// memStorage is a storageLayer keeping every bucket in memory.
+type memStorage struct {
+	blockchain []byte
+	buckets    map[string]map[string][]byte
+}
+
+func newMemStorage() *memStorage {
+	s := &memStorage{buckets: map[string]map[string][]byte{}}
+	s.ClearBlocks()
+	return s
+}
+
+func (s *memStorage) find(bucket string, key []byte) ([]byte, error) {
+	data, ok := s.buckets[bucket][string(key)]
+	if !ok {
+		return nil, errors.New("Not found")
+	}
+	return data, nil
+}
+func (s *memStorage) forEach(bucket string, fn func(key []byte, data []byte)) {
+	for key, data := range s.buckets[bucket] {
+		fn([]byte(key), data)
+	}
+}
+
+func (s *memStorage) GetBlockchain() []byte      { return s.blockchain }
+func (s *memStorage) SaveBlockchain(data []byte) { s.blockchain = data }
+func (s *memStorage) ClearBlocks() {
+	s.buckets["blocks"] = map[string][]byte{}
+	s.ClearIndexes()
+}
+func (s *memStorage) ClearIndexes() {
+	for _, bucket := range []string{"headers", "utxo", "undo"} {
+		s.buckets[bucket] = map[string][]byte{}
+	}
+}
+func (s *memStorage) FindBlock(key []byte) ([]byte, error)  { return s.find("blocks", key) }
+func (s *memStorage) FindHeader(key []byte) ([]byte, error) { return s.find("headers", key) }
+func (s *memStorage) FindUTxOut(key []byte) ([]byte, error) { return s.find("utxo", key) }
+func (s *memStorage) FindUndo(key []byte) ([]byte, error)   { return s.find("undo", key) }
+func (s *memStorage) ForEachUTxOut(fn func(key []byte, data []byte)) {
+	s.forEach("utxo", fn)
+}
+func (s *memStorage) ForEachBlock(fn func(key []byte, data []byte)) {
+	s.forEach("blocks", fn)
+}
+func (s *memStorage) ConnectBlock(key []byte, block []byte, header []byte, undo []byte, spent [][]byte, created map[string][]byte) {
+	s.buckets["blocks"][string(key)] = block
+	s.buckets["headers"][string(key)] = header
+	s.buckets["undo"][string(key)] = undo
+	for _, outpoint := range spent {
+		delete(s.buckets["utxo"], string(outpoint))
+	}
+	for outpoint, data := range created {
+		s.buckets["utxo"][outpoint] = data
+	}
+}
+func (s *memStorage) LoadSnapshot(headers map[string][]byte, key []byte, block []byte, utxos map[string][]byte) {
+	s.ClearBlocks()
+	s.buckets["blocks"][string(key)] = block
+	for hash, header := range headers {
+		s.buckets["headers"][hash] = header
+	}
+	for outpoint, data := range utxos {
+		s.buckets["utxo"][outpoint] = data
+	}
+}
+func (s *memStorage) DeleteBlock(key []byte) int {
+	freed := len(s.buckets["blocks"][string(key)])
+	delete(s.buckets["blocks"], string(key))
+	delete(s.buckets["undo"], string(key))
+	return freed
+}
+func (s *memStorage) BlocksSize() int {
+	size := 0
+	s.forEach("blocks", func(key []byte, data []byte) { size += len(data) })
+	return size
+}
+
+// storeTestChain connects testChain to a fresh memStorage.
+func storeTestChain() (*memStorage, []*Block) {
+	s := newMemStorage()
+	storage = s
+	chain := testChain()
+	for _, block := range chain {
+		persistBlock(block)
+	}
+	PersistBlockchain(&blockchain{LastHash: chain[len(chain)-1].Hash})
+	return s, chain
+}
+
+func TestVerifyChain(t *testing.T) {
+	defer withParams(&chainParams{ChainId: "test", Checkpoints: map[int]string{}})()
+	defer func() { storage = testStorage{} }()
+
+	t.Run("should accept an intact chain at every level", func(t *testing.T) {
+		storeTestChain()
+		for level := CheckHeaders; level <= MaxCheckLevel; level++ {
+			checked, err := VerifyChain(level, 0)
+			if err != nil || checked != 2 {
+				t.Errorf("Level %d, Expected: 2 blocks, Got: %d %v", level, checked, err)
+			}
+		}
+	})
+	t.Run("should only check the requested depth", func(t *testing.T) {
+		storeTestChain()
+		if checked, _ := VerifyChain(CheckUTXO, 1); checked != 1 {
+			t.Errorf("Expected: 1, Got: %d", checked)
+		}
+	})
+	t.Run("should find a corrupted block body", func(t *testing.T) {
+		s, chain := storeTestChain()
+		corrupted := *chain[1]
+		corrupted.Transactions = corrupted.Transactions[1:]
+		s.buckets["blocks"][chain[1].Hash] = utils.ToBytes(&corrupted)
+		if _, err := VerifyChain(CheckHeaders, 0); err != nil {
+			t.Errorf("Expected headers to pass, Got: %v", err)
+		}
+		if _, err := VerifyChain(CheckBodies, 0); !errors.Is(err, errBadCommitment) {
+			t.Errorf("Expected: %v, Got: %v", errBadCommitment, err)
+		}
+	})
+	t.Run("should report a body that does not decode", func(t *testing.T) {
+		s, chain := storeTestChain()
+		s.buckets["blocks"][chain[1].Hash] = []byte("corrupt")
+		if _, err := VerifyChain(CheckBodies, 0); !errors.Is(err, errCorruptData) {
+			t.Errorf("Expected: %v, Got: %v", errCorruptData, err)
+		}
+	})
+	t.Run("should find a drifted UTXO set", func(t *testing.T) {
+		s, _ := storeTestChain()
+		s.buckets["utxo"]["other:0"] = utils.ToBytes(&TxOut{Address: "other", Amount: 1})
+		if _, err := VerifyChain(CheckUndo, 0); err != nil {
+			t.Errorf("Expected undo to pass, Got: %v", err)
+		}
+		if _, err := VerifyChain(CheckUTXO, 0); err != errUTXOMismatch {
+			t.Errorf("Expected: %v, Got: %v", errUTXOMismatch, err)
+		}
+	})
+	t.Run("should refuse to check pruned bodies", func(t *testing.T) {
+		s, chain := storeTestChain()
+		PersistBlockchain(&blockchain{LastHash: chain[1].Hash, PrunedHeight: 1})
+		s.DeleteBlock([]byte(chain[0].Hash))
+		if _, err := VerifyChain(CheckBodies, 0); err != errPrunedChain {
+			t.Errorf("Expected: %v, Got: %v", errPrunedChain, err)
+		}
+		if _, err := VerifyChain(CheckUndo, 1); err != nil {
+			t.Errorf("Expected recent blocks to pass, Got: %v", err)
+		}
+	})
+}
+
+func TestReindex(t *testing.T) {
+	defer withParams(&chainParams{ChainId: "test", Checkpoints: map[int]string{}})()
+	defer func() { storage = testStorage{} }()
+
+	t.Run("should rebuild the indexes from the blocks", func(t *testing.T) {
+		s, chain := storeTestChain()
+		s.ClearIndexes()
+		s.blockchain = nil
+		height, err := Reindex()
+		if err != nil || height != 2 {
+			t.Fatalf("Expected: 2, Got: %d %v", height, err)
+		}
+		stored, _ := storedChain()
+		if stored.LastHash != chain[1].Hash {
+			t.Errorf("Expected tip: %s, Got: %s", chain[1].Hash, stored.LastHash)
+		}
+		if _, err := VerifyChain(CheckUTXO, 0); err != nil {
+			t.Errorf("Expected: nil, Got: %v", err)
+		}
+	})
+	t.Run("should ignore blocks not linked to genesis", func(t *testing.T) {
+		s, chain := storeTestChain()
+		orphan := mineTestBlock(&Block{Hash: "unknown", Height: 2}, 0)
+		s.buckets["blocks"][orphan.Hash] = utils.ToBytes(orphan)
+		if height, err := Reindex(); err != nil || height != 2 {
+			t.Errorf("Expected: 2, Got: %d %v", height, err)
+		}
+		if stored, _ := storedChain(); stored.LastHash != chain[1].Hash {
+			t.Errorf("Expected tip: %s, Got: %s", chain[1].Hash, stored.LastHash)
+		}
+	})
+	t.Run("should skip bodies that do not decode", func(t *testing.T) {
+		s, _ := storeTestChain()
+		s.buckets["blocks"]["corrupt"] = []byte("corrupt")
+		if height, err := Reindex(); err != nil || height != 2 {
+			t.Errorf("Expected: 2, Got: %d %v", height, err)
+		}
+	})
+	t.Run("should keep the valid part of a chain", func(t *testing.T) {
+		s, chain := storeTestChain()
+		third := mineTestBlock(chain[1], 0)
+		invalid := *third
+		invalid.Transactions = []*Tx{chain[1].Transactions[0], third.Transactions[0]}
+		invalid.MerkleRoot, invalid.WitnessRoot = txRoots(invalid.Transactions)
+		invalid.Mine(nil)
+		s.buckets["blocks"][invalid.Hash] = utils.ToBytes(&invalid)
+		if height, err := Reindex(); err != nil || height != 2 {
+			t.Errorf("Expected: 2, Got: %d %v", height, err)
+		}
+		if stored, _ := storedChain(); stored.LastHash != chain[1].Hash {
+			t.Errorf("Expected tip: %s, Got: %s", chain[1].Hash, stored.LastHash)
+		}
+	})
+	t.Run("should refuse a pruned node", func(t *testing.T) {
+		_, chain := storeTestChain()
+		PersistBlockchain(&blockchain{LastHash: chain[1].Hash, PrunedHeight: 1})
+		if _, err := Reindex(); err != errPrunedChain {
+			t.Errorf("Expected: %v, Got: %v", errPrunedChain, err)
+		}
+	})
+}
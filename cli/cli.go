@@ -1,26 +1,121 @@
 package cli
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
+	"os"
 	"runtime"
+	"strings"
 
+	"github.com/fantasticake/simple-coin/blockchain"
 	"github.com/fantasticake/simple-coin/explorer"
+	"github.com/fantasticake/simple-coin/miner"
 	"github.com/fantasticake/simple-coin/rest"
+	"github.com/fantasticake/simple-coin/utils"
+	"github.com/fantasticake/simple-coin/wallet"
 )
 
 func usage() {
 	fmt.Printf("Please use the following flags:\n")
-	fmt.Printf("-mode: Start a server with a mode: 'rest','html' (default 'rest')\n")
-	fmt.Printf("-port: Set port for a server (default 4000)\n\n")
+	fmt.Printf("-mode: Start a server with a mode: 'rest','html', or run 'verifychain','reindex','export','import','dumputxo','createwallet','restorewallet' (default 'rest')\n")
+	fmt.Printf("-port: Set port for a server (default 4000)\n")
+	fmt.Printf("-mine: Keep mining blocks in the background\n")
+	fmt.Printf("-workers: Set number of mining goroutines (default number of CPUs)\n")
+	fmt.Printf("-pool: Hand out pool work and split rewards over shares\n")
+	fmt.Printf("-miningaddress: Pay block rewards to an address instead of the wallet\n")
+	fmt.Printf("-network: Set network: 'main','test' (default 'main')\n")
+	fmt.Printf("-assumevalid: Skip signatures of this block and its ancestors while syncing (default none, all signatures are checked)\n")
+	fmt.Printf("-prune: Keep about this many MB of old blocks, deleting older bodies (default 0, keep all)\n")
+	fmt.Printf("-checklevel: How thoroughly verifychain checks blocks, 0-3 (default 3)\n")
+	fmt.Printf("-checkblocks: How many recent blocks verifychain checks, 0 for all (default 6)\n")
+	fmt.Printf("-file: File for export, import and dumputxo (default 'bootstrap.dat')\n")
+	fmt.Printf("-snapshotheight: Height of the UTXO set dumputxo writes, 0 for the tip (default 0)\n")
+	fmt.Printf("-loadsnapshot: Start an empty node from a pinned UTXO snapshot file\n")
+	fmt.Printf("-assumeutxo: Pin a trusted snapshot for loadsnapshot as <block hash>:<UTXO hash>, none are pinned by default\n")
+	fmt.Printf("-keytype: Signature scheme of createwallet and restorewallet: 'p256','secp256k1','ed25519','schnorr' (default 'p256')\n")
+	fmt.Printf("-wallet: Name of the wallet createwallet and restorewallet write (default 'default')\n")
+	fmt.Printf("createwallet reads an optional seed passphrase, restorewallet the recovery words and the passphrase, from stdin\n\n")
 	runtime.Goexit()
 }
 
 func Start() {
-	mode := flag.String("mode", "rest", "Start a server with a mode: 'rest','html'")
+	mode := flag.String("mode", "rest", "Start a server with a mode: 'rest','html', or run 'verifychain','reindex','export','import','dumputxo','createwallet','restorewallet'")
 	port := flag.Int("port", 4000, "Set port for a server")
+	mine := flag.Bool("mine", false, "Keep mining blocks in the background")
+	workers := flag.Int("workers", runtime.NumCPU(), "Set number of mining goroutines")
+	pool := flag.Bool("pool", false, "Hand out pool work and split rewards over shares")
+	miningAddress := flag.String("miningaddress", "", "Pay block rewards to an address instead of the wallet")
+	network := flag.String("network", "main", "Set network: 'main','test'")
+	assumeValid := flag.String("assumevalid", "", "Skip signatures of this block and its ancestors while syncing, none by default")
+	prune := flag.Int("prune", 0, "Keep about this many MB of old blocks, deleting older bodies")
+	checkLevel := flag.Int("checklevel", blockchain.MaxCheckLevel, "How thoroughly verifychain checks blocks, 0-3")
+	checkBlocks := flag.Int("checkblocks", 6, "How many recent blocks verifychain checks, 0 for all")
+	file := flag.String("file", "bootstrap.dat", "File for export, import and dumputxo")
+	snapshotHeight := flag.Int("snapshotheight", 0, "Height of the UTXO set dumputxo writes, 0 for the tip")
+	loadSnapshot := flag.String("loadsnapshot", "", "Start an empty node from a pinned UTXO snapshot file")
+	assumeUTXO := flag.String("assumeutxo", "", "Pin a trusted snapshot for loadsnapshot as <block hash>:<UTXO hash>, none by default")
+	keyType := flag.String("keytype", "p256", "Signature scheme of createwallet and restorewallet: 'p256','secp256k1','ed25519','schnorr'")
+	walletName := flag.String("wallet", wallet.DefaultWallet, "Name of the wallet createwallet and restorewallet write")
 	flag.Parse()
 
+	if blockchain.SetNetwork(*network) != nil {
+		usage()
+	}
+	if *miningAddress != "" && wallet.ValidateAddress(*miningAddress) != nil {
+		fmt.Printf("Invalid mining address: %s\n", *miningAddress)
+		return
+	}
+	if *assumeValid != "" {
+		blockchain.SetAssumeValid(*assumeValid)
+	}
+	if *assumeUTXO != "" {
+		if err := blockchain.SetAssumeUTXO(*assumeUTXO); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	// Maintenance modes run before anything loads the chain.
+	switch *mode {
+	case "verifychain":
+		verifyChain(*checkLevel, *checkBlocks)
+		return
+	case "reindex":
+		reindex()
+		return
+	case "export":
+		exportChain(*file)
+		return
+	case "import":
+		importChain(*file)
+		return
+	case "dumputxo":
+		dumpUTXO(*file, *snapshotHeight)
+		return
+	case "createwallet":
+		createWallet(*walletName, *keyType)
+		return
+	case "restorewallet":
+		restoreWallet(*walletName, *keyType)
+		return
+	}
+
+	if *loadSnapshot != "" {
+		loadUTXOSnapshot(*loadSnapshot)
+	}
+
+	blockchain.SetPruneTarget(*prune)
+	blockchain.SetMiningWorkers(*workers)
+	blockchain.SetMiningAddress(*miningAddress)
+
+	if *pool {
+		miner.EnablePool()
+	}
+	if *mine {
+		utils.HandleErr(miner.Miner().Start())
+	}
+
 	switch *mode {
 	case "rest":
 		rest.Start(*port)
@@ -30,3 +125,131 @@ func Start() {
 		usage()
 	}
 }
+
+func verifyChain(level int, depth int) {
+	checked, err := blockchain.VerifyChain(level, depth)
+	if err != nil {
+		fmt.Printf("Chain verification failed: %s\n", err)
+		return
+	}
+	fmt.Printf("Verified %d blocks at level %d\n", checked, level)
+}
+
+func reindex() {
+	height, err := blockchain.Reindex()
+	if err != nil {
+		fmt.Printf("Reindex failed: %s\n", err)
+		return
+	}
+	fmt.Printf("Reindexed %d blocks\n", height)
+}
+
+func exportChain(path string) {
+	file, err := os.Create(path)
+	utils.HandleErr(err)
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	exported, err := blockchain.ExportChain(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		fmt.Printf("Export failed: %s\n", err)
+		return
+	}
+	fmt.Printf("Exported %d blocks to %s\n", exported, path)
+}
+
+func importChain(path string) {
+	file, err := os.Open(path)
+	utils.HandleErr(err)
+	defer file.Close()
+	imported, err := blockchain.ImportChain(file)
+	if err != nil {
+		fmt.Printf("Import stopped after %d blocks: %s\n", imported, err)
+		return
+	}
+	fmt.Printf("Imported %d blocks from %s\n", imported, path)
+}
+
+func dumpUTXO(path string, height int) {
+	file, err := os.Create(path)
+	utils.HandleErr(err)
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	info, err := blockchain.DumpUTXO(writer, height)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		fmt.Printf("Snapshot failed: %s\n", err)
+		return
+	}
+	fmt.Printf("Wrote %d outputs at block %d to %s\n", info.UTXOCount, info.Height, path)
+	fmt.Printf("Block hash: %s\nUTXO hash: %s\n", info.BlockHash, info.UTXOHash)
+}
+
+// loadUTXOSnapshot exits when the snapshot can't be loaded, rather than
+// starting on an empty or old chain.
+func loadUTXOSnapshot(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Snapshot not loaded: %s\n", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+	info, err := blockchain.LoadSnapshot(bufio.NewReader(file))
+	if err != nil {
+		fmt.Printf("Snapshot not loaded: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Loaded %d outputs at block %d, validating history from peers\n", info.UTXOCount, info.Height)
+}
+
+// readLine prompts for a line of stdin, so secrets stay out of the
+// process arguments and the shell history.
+func readLine(stdin *bufio.Reader, prompt string) string {
+	fmt.Print(prompt)
+	// Piped input may end without a newline, what was read still counts.
+	line, _ := stdin.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+func createWallet(name string, keyTypeName string) {
+	keyType, err := wallet.ParseKeyType(keyTypeName)
+	if err != nil {
+		fmt.Printf("Creating the wallet failed: %s\n", err)
+		return
+	}
+	passphrase := readLine(bufio.NewReader(os.Stdin), "Seed passphrase (optional): ")
+	w, mnemonic, err := wallet.Create(name, passphrase, keyType)
+	if err != nil {
+		fmt.Printf("Creating the wallet failed: %s\n", err)
+		return
+	}
+	fmt.Printf("Created %s wallet %s %s\n", keyType, w.Name, w.Address)
+	fmt.Printf("Write down these words, with the passphrase they restore the wallet:\n%s\n", mnemonic)
+}
+
+func restoreWallet(name string, keyTypeName string) {
+	keyType, err := wallet.ParseKeyType(keyTypeName)
+	if err != nil {
+		fmt.Printf("Restoring the wallet failed: %s\n", err)
+		return
+	}
+	stdin := bufio.NewReader(os.Stdin)
+	mnemonic := readLine(stdin, "Recovery words: ")
+	passphrase := readLine(stdin, "Seed passphrase (optional): ")
+	w, err := wallet.Restore(name, mnemonic, passphrase, keyType)
+	if err != nil {
+		fmt.Printf("Restoring the wallet failed: %s\n", err)
+		return
+	}
+	fmt.Printf("Restored wallet %s %s\n", w.Name, w.Address)
+	used, err := blockchain.RescanWallet(w)
+	if err != nil {
+		fmt.Printf("Rescanning the chain failed: %s\n", err)
+		return
+	}
+	fmt.Printf("Found %d used addresses\n", used)
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"encoding/binary"
 	"errors"
 
 	"github.com/fantasticake/simple-coin/utils"
@@ -11,8 +12,17 @@ var (
 	db            *bbolt.DB
 	dbName        = "database.db"
 	blocksBucket  = "blocksBucket"
+	headersBucket = "headersBucket"
+	utxoBucket    = "utxoBucket"
+	undoBucket    = "undoBucket"
 	dataBucket    = "dataBucket"
 	blockchainKey = "blockchainKey"
+	// blocksSizeKey holds the running total of bytes in blocksBucket.
+	blocksSizeKey = "blocksSizeKey"
+
+	// indexBuckets hold everything derived from the blocks.
+	indexBuckets = []string{headersBucket, utxoBucket, undoBucket}
+	chainBuckets = append([]string{blocksBucket}, indexBuckets...)
 )
 
 func DB() *bbolt.DB {
@@ -21,12 +31,16 @@ func DB() *bbolt.DB {
 		db = database
 		utils.HandleErr(err)
 		err = db.Update(func(tx *bbolt.Tx) error {
-			_, err = tx.CreateBucketIfNotExists([]byte(blocksBucket))
-			if err != nil {
-				return err
+			for _, bucket := range append(chainBuckets, dataBucket) {
+				_, err = tx.CreateBucketIfNotExists([]byte(bucket))
+				if err != nil {
+					return err
+				}
 			}
-			_, err = tx.CreateBucketIfNotExists([]byte(dataBucket))
-			return err
+			if tx.Bucket([]byte(dataBucket)).Get([]byte(blocksSizeKey)) == nil {
+				return addBlocksSize(tx, scanBlocksSize(tx))
+			}
+			return nil
 		})
 		utils.HandleErr(err)
 	}
@@ -46,11 +60,68 @@ func SaveBlockchain(data []byte) {
 	utils.HandleErr(err)
 }
 
-func SaveBlock(key []byte, data []byte) {
+// ConnectBlock stores a block with its header and undo data and applies its
+// changes to the UTXO set in one transaction.
+func ConnectBlock(key []byte, block []byte, header []byte, undo []byte, spent [][]byte, created map[string][]byte) {
 	err := DB().Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte(blocksBucket))
-		err := bucket.Put(key, data)
-		return err
+		blocks := tx.Bucket([]byte(blocksBucket))
+		if err := addBlocksSize(tx, len(block)-len(blocks.Get(key))); err != nil {
+			return err
+		}
+		if err := blocks.Put(key, block); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(headersBucket)).Put(key, header); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(undoBucket)).Put(key, undo); err != nil {
+			return err
+		}
+		utxos := tx.Bucket([]byte(utxoBucket))
+		for _, outpoint := range spent {
+			if err := utxos.Delete(outpoint); err != nil {
+				return err
+			}
+		}
+		for outpoint, data := range created {
+			if err := utxos.Put([]byte(outpoint), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	utils.HandleErr(err)
+}
+
+// LoadSnapshot replaces the chain with the headers, the tip block and the
+// UTXO set of a snapshot in one transaction.
+func LoadSnapshot(headers map[string][]byte, key []byte, block []byte, utxos map[string][]byte) {
+	err := DB().Update(func(tx *bbolt.Tx) error {
+		for _, bucket := range chainBuckets {
+			if err := tx.DeleteBucket([]byte(bucket)); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket([]byte(bucket)); err != nil {
+				return err
+			}
+		}
+		if err := tx.Bucket([]byte(blocksBucket)).Put(key, block); err != nil {
+			return err
+		}
+		if err := setBlocksSize(tx, len(block)); err != nil {
+			return err
+		}
+		for hash, header := range headers {
+			if err := tx.Bucket([]byte(headersBucket)).Put([]byte(hash), header); err != nil {
+				return err
+			}
+		}
+		for outpoint, data := range utxos {
+			if err := tx.Bucket([]byte(utxoBucket)).Put([]byte(outpoint), data); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
 	utils.HandleErr(err)
 }
@@ -65,11 +136,13 @@ func GetBlockchain() []byte {
 	return data
 }
 
-func FindBlock(key []byte) ([]byte, error) {
+func find(bucketName string, key []byte) ([]byte, error) {
 	var data []byte
 	DB().View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte(blocksBucket))
-		data = bucket.Get(key)
+		bucket := tx.Bucket([]byte(bucketName))
+		if value := bucket.Get(key); value != nil {
+			data = append([]byte{}, value...)
+		}
 		return nil
 	})
 	if data == nil {
@@ -78,12 +151,120 @@ func FindBlock(key []byte) ([]byte, error) {
 	return data, nil
 }
 
+func FindBlock(key []byte) ([]byte, error) {
+	return find(blocksBucket, key)
+}
+
+func FindHeader(key []byte) ([]byte, error) {
+	return find(headersBucket, key)
+}
+
+func FindUTxOut(key []byte) ([]byte, error) {
+	return find(utxoBucket, key)
+}
+
+func FindUndo(key []byte) ([]byte, error) {
+	return find(undoBucket, key)
+}
+
+// ForEachUTxOut calls fn with every entry of the UTXO set.
+func ForEachUTxOut(fn func(key []byte, data []byte)) {
+	DB().View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(utxoBucket)).ForEach(func(k, v []byte) error {
+			fn(k, v)
+			return nil
+		})
+	})
+}
+
+// ForEachBlock calls fn with every stored block body.
+func ForEachBlock(fn func(key []byte, data []byte)) {
+	DB().View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(blocksBucket)).ForEach(func(k, v []byte) error {
+			fn(k, v)
+			return nil
+		})
+	})
+}
+
+// DeleteBlock removes the body and undo data of a block, keeping its
+// header, and returns how many bytes of blocks it freed.
+func DeleteBlock(key []byte) int {
+	var freed int
+	err := DB().Update(func(tx *bbolt.Tx) error {
+		blocks := tx.Bucket([]byte(blocksBucket))
+		freed = len(blocks.Get(key))
+		if err := addBlocksSize(tx, -freed); err != nil {
+			return err
+		}
+		if err := blocks.Delete(key); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(undoBucket)).Delete(key)
+	})
+	utils.HandleErr(err)
+	return freed
+}
+
+// BlocksSize is the number of bytes taken by stored block bodies.
+func BlocksSize() int {
+	var size int
+	DB().View(func(tx *bbolt.Tx) error {
+		size = getBlocksSize(tx)
+		return nil
+	})
+	return size
+}
+
+func getBlocksSize(tx *bbolt.Tx) int {
+	data := tx.Bucket([]byte(dataBucket)).Get([]byte(blocksSizeKey))
+	if data == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(data))
+}
+
+func setBlocksSize(tx *bbolt.Tx, size int) error {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(size))
+	return tx.Bucket([]byte(dataBucket)).Put([]byte(blocksSizeKey), data)
+}
+
+func addBlocksSize(tx *bbolt.Tx, delta int) error {
+	return setBlocksSize(tx, getBlocksSize(tx)+delta)
+}
+
+// scanBlocksSize adds up the stored block bodies, for databases written
+// before the running total was kept.
+func scanBlocksSize(tx *bbolt.Tx) int {
+	var size int
+	tx.Bucket([]byte(blocksBucket)).ForEach(func(k, v []byte) error {
+		size += len(v)
+		return nil
+	})
+	return size
+}
+
 func ClearBlocks() {
+	clearBuckets(chainBuckets)
+	utils.HandleErr(DB().Update(func(tx *bbolt.Tx) error {
+		return setBlocksSize(tx, 0)
+	}))
+}
+
+// ClearIndexes drops everything derived from the blocks but the blocks.
+func ClearIndexes() {
+	clearBuckets(indexBuckets)
+}
+
+func clearBuckets(buckets []string) {
 	DB().Update(func(tx *bbolt.Tx) error {
-		err := tx.DeleteBucket([]byte(blocksBucket))
-		utils.HandleErr(err)
-		_, err = tx.CreateBucket([]byte(blocksBucket))
-		utils.HandleErr(err)
+		for _, bucket := range buckets {
+			err := tx.DeleteBucket([]byte(bucket))
+			utils.HandleErr(err)
+			_, err = tx.CreateBucket([]byte(bucket))
+			utils.HandleErr(err)
+		}
 		return nil
 	})
 }
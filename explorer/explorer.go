@@ -1,20 +1,29 @@
 package explorer
 
 import (
+	"errors"
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
-	"text/template"
 
 	"github.com/fantasticake/simple-coin/blockchain"
+	"github.com/fantasticake/simple-coin/wallet"
 )
 
 type homeData struct {
 	Blocks []*blockchain.Block
 }
 
+type addData struct {
+	Data  string
+	Error string
+}
+
 var templates *template.Template
 
+var errEmptyData = errors.New("Data should not be empty")
+
 func home(w http.ResponseWriter, r *http.Request) {
 	data := homeData{blockchain.Blocks(blockchain.BC())}
 	err := templates.ExecuteTemplate(w, "home", data)
@@ -26,15 +35,33 @@ func home(w http.ResponseWriter, r *http.Request) {
 func add(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		err := templates.ExecuteTemplate(w, "add", nil)
+		err := templates.ExecuteTemplate(w, "add", addData{})
 		if err != nil {
 			fmt.Println(err)
 		}
 	case http.MethodPost:
-		/* r.ParseForm()
+		r.ParseForm()
 		data := r.Form.Get("data")
-		blockchain.BC().AddBlock(data)
-		http.Redirect(w, r, "/", http.StatusPermanentRedirect) */
+		if data == "" {
+			renderAdd(w, addData{Error: errEmptyData.Error()})
+			return
+		}
+		_, err := blockchain.Mempool().AddData(blockchain.BC(), wallet.Wallet(), []byte(data), "")
+		if err != nil {
+			renderAdd(w, addData{Data: data, Error: err.Error()})
+			return
+		}
+		blockchain.BC().AddBlock()
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// renderAdd shows the add page again with what went wrong.
+func renderAdd(w http.ResponseWriter, data addData) {
+	w.WriteHeader(http.StatusBadRequest)
+	err := templates.ExecuteTemplate(w, "add", data)
+	if err != nil {
+		fmt.Println(err)
 	}
 }
 
@@ -3,9 +3,16 @@ module github.com/fantasticake/simple-coin
 go 1.19
 
 require (
+	github.com/btcsuite/btcd/btcec/v2 v2.3.2
 	github.com/gorilla/mux v1.8.0
 	github.com/gorilla/websocket v1.5.0
 	go.etcd.io/bbolt v1.3.6
+	golang.org/x/crypto v0.3.0
 )
 
-require golang.org/x/sys v0.3.0 // indirect
+require (
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
+	golang.org/x/sys v0.3.0 // indirect
+)
@@ -0,0 +1,134 @@
+package miner
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fantasticake/simple-coin/blockchain"
+	"github.com/fantasticake/simple-coin/p2p"
+)
+
+type miner struct {
+	running     bool
+	blocksMined atomic.Int64
+	hashRate    atomic.Uint64
+	stop        chan struct{}
+	done        chan struct{}
+	m           sync.Mutex
+}
+
+type Status struct {
+	Running     bool   `json:"running"`
+	Workers     int    `json:"workers"`
+	HashRate    uint64 `json:"hashRate"`
+	BlocksMined int64  `json:"blocksMined"`
+}
+
+var (
+	mn   *miner
+	once sync.Once
+)
+
+func Miner() *miner {
+	once.Do(func() {
+		mn = &miner{}
+	})
+	return mn
+}
+
+func (mn *miner) Start() error {
+	mn.m.Lock()
+	defer mn.m.Unlock()
+	if mn.running {
+		return errors.New("Miner is already running")
+	}
+	mn.running = true
+	mn.stop = make(chan struct{})
+	mn.done = make(chan struct{})
+	go mn.run(mn.stop, mn.done)
+	return nil
+}
+
+func (mn *miner) Stop() error {
+	mn.m.Lock()
+	defer mn.m.Unlock()
+	if !mn.running {
+		return errors.New("Miner is not running")
+	}
+	close(mn.stop)
+	<-mn.done
+	mn.running = false
+	return nil
+}
+
+func GetStatus(mn *miner) Status {
+	mn.m.Lock()
+	defer mn.m.Unlock()
+	return Status{
+		Running:     mn.running,
+		Workers:     blockchain.MiningWorkers(),
+		HashRate:    mn.hashRate.Load(),
+		BlocksMined: mn.blocksMined.Load(),
+	}
+}
+
+// run keeps mining templates on top of the tip. A template is dropped and
+// rebuilt as soon as the tip moves or new transactions arrive.
+func (mn *miner) run(stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	go mn.measureHashRate(stop)
+	changes, unsubscribe := blockchain.Subscribe()
+	defer unsubscribe()
+	for {
+		drain(changes)
+		block := blockchain.NewBlockTemplate(blockchain.BC())
+		abort := make(chan struct{})
+		found := make(chan bool)
+		go func() {
+			found <- block.Mine(abort)
+		}()
+
+		select {
+		case <-stop:
+			close(abort)
+			<-found
+			return
+		case <-changes:
+			close(abort)
+			<-found
+		case ok := <-found:
+			if ok && blockchain.BC().AddMinedBlock(block) == nil {
+				p2p.BroadcastNewBlock(block)
+				mn.blocksMined.Add(1)
+			}
+		}
+	}
+}
+
+// measureHashRate samples the hash counter every second until stop is
+// closed.
+func (mn *miner) measureHashRate(stop chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	last := blockchain.HashCount()
+	for {
+		select {
+		case <-stop:
+			mn.hashRate.Store(0)
+			return
+		case <-ticker.C:
+			count := blockchain.HashCount()
+			mn.hashRate.Store(count - last)
+			last = count
+		}
+	}
+}
+
+func drain(ch <-chan struct{}) {
+	select {
+	case <-ch:
+	default:
+	}
+}
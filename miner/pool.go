@@ -0,0 +1,250 @@
+package miner
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fantasticake/simple-coin/blockchain"
+	"github.com/fantasticake/simple-coin/p2p"
+)
+
+type share struct {
+	Address string
+	Time    int
+}
+
+type MinerStats struct {
+	Address      string `json:"address"`
+	Shares       int    `json:"shares"`
+	WindowShares int    `json:"windowShares"`
+	BlocksFound  int    `json:"blocksFound"`
+	LastShare    int    `json:"lastShare"`
+}
+
+type PoolTemplate struct {
+	Template
+	ShareDifficulty int    `json:"shareDifficulty"`
+	ShareTarget     string `json:"shareTarget"`
+}
+
+type pool struct {
+	enabled bool
+	window  []share
+	stats   map[string]*MinerStats
+	// seen holds the submitted solutions per template id.
+	seen map[string]map[Solution]bool
+	m    sync.Mutex
+}
+
+var (
+	pplnsWindow      int = 100 // shares the block reward is split over
+	shareDiffPenalty int = 1   // how many zeros a share needs less than a block
+
+	errPoolDisabled = errors.New("Pool mode is off")
+	errNoAddress    = errors.New("Payout address is required")
+	errDuplicate    = errors.New("Share was already submitted")
+	errLowShare     = errors.New("Share does not meet the share target")
+	errStaleShare   = errors.New("Share is for an old tip")
+
+	pl = &pool{
+		stats: make(map[string]*MinerStats),
+		seen:  make(map[string]map[Solution]bool),
+	}
+)
+
+func EnablePool() {
+	pl.m.Lock()
+	defer pl.m.Unlock()
+	pl.enabled = true
+}
+
+func PoolEnabled() bool {
+	pl.m.Lock()
+	defer pl.m.Unlock()
+	return pl.enabled
+}
+
+func shareDifficulty(difficulty int) int {
+	if difficulty-shareDiffPenalty < 1 {
+		return 1
+	}
+	return difficulty - shareDiffPenalty
+}
+
+// splitReward divides value over the addresses in window in proportion to
+// their shares. What rounding leaves over goes to the address with the most
+// shares.
+func splitReward(window []share, value int) []*blockchain.TxOut {
+	counts := make(map[string]int)
+	for _, s := range window {
+		counts[s.Address] += 1
+	}
+	var addresses []string
+	for address := range counts {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		if counts[addresses[i]] != counts[addresses[j]] {
+			return counts[addresses[i]] > counts[addresses[j]]
+		}
+		return addresses[i] < addresses[j]
+	})
+
+	var outs []*blockchain.TxOut
+	paid := 0
+	for _, address := range addresses {
+		amount := value * counts[address] / len(window)
+		paid += amount
+		outs = append(outs, &blockchain.TxOut{Address: address, Amount: amount})
+	}
+	if len(outs) > 0 {
+		outs[0].Amount += value - paid
+	}
+	var payouts []*blockchain.TxOut
+	for _, out := range outs {
+		if out.Amount > 0 {
+			payouts = append(payouts, out)
+		}
+	}
+	return payouts
+}
+
+// GetPoolTemplate hands out work whose coinbase pays the miners of the last
+// pplnsWindow shares. Shares solving it are credited to address.
+func GetPoolTemplate(address string) (*PoolTemplate, error) {
+	if !PoolEnabled() {
+		return nil, errPoolDisabled
+	}
+	if address == "" {
+		return nil, errNoAddress
+	}
+	block := blockchain.NewBlockTemplate(blockchain.BC())
+	pl.m.Lock()
+	payouts := splitReward(pl.window, block.CoinbaseValue())
+	pl.m.Unlock()
+	if len(payouts) > 0 {
+		block.SetCoinbaseOutputs(payouts)
+	}
+	block.TagCoinbase(address)
+	templates.add(block, address)
+	pl.m.Lock()
+	pl.pruneSeen()
+	pl.m.Unlock()
+	difficulty := shareDifficulty(block.Difficulty)
+	return &PoolTemplate{
+		Template:        *newTemplate(block),
+		ShareDifficulty: difficulty,
+		ShareTarget:     (&blockchain.Block{Difficulty: difficulty}).Target(),
+	}, nil
+}
+
+// SubmitShare credits a share to the miner the template was issued to and,
+// when the share also meets the block difficulty, adds the block to the
+// chain.
+func SubmitShare(solution *Solution) (*MinerStats, error) {
+	if !PoolEnabled() {
+		return nil, errPoolDisabled
+	}
+	block, address, ok := templates.get(solution.Id)
+	if !ok || address == "" {
+		return nil, errUnknownTemplate
+	}
+	if block.PrevHash != blockchain.TipHash(blockchain.BC()) {
+		return nil, errStaleShare
+	}
+	block.SetSolution(solution.Nonce, solution.Timestamp)
+	if !strings.HasPrefix(block.Hash, strings.Repeat("0", shareDifficulty(block.Difficulty))) {
+		return nil, errLowShare
+	}
+
+	pl.m.Lock()
+	if pl.seen[solution.Id][*solution] {
+		pl.m.Unlock()
+		return nil, errDuplicate
+	}
+	if pl.seen[solution.Id] == nil {
+		pl.seen[solution.Id] = make(map[Solution]bool)
+	}
+	pl.seen[solution.Id][*solution] = true
+	stats := pl.credit(address)
+	pl.m.Unlock()
+
+	if blockchain.BC().AddMinedBlock(&block) == nil {
+		templates.remove(solution.Id)
+		p2p.BroadcastNewBlock(&block)
+		pl.m.Lock()
+		stats.BlocksFound += 1
+		delete(pl.seen, solution.Id)
+		pl.m.Unlock()
+	}
+	return GetMinerStats(address)
+}
+
+func (p *pool) credit(address string) *MinerStats {
+	p.window = append(p.window, share{address, int(time.Now().Unix())})
+	if len(p.window) > pplnsWindow {
+		p.window = p.window[len(p.window)-pplnsWindow:]
+	}
+	stats, ok := p.stats[address]
+	if !ok {
+		stats = &MinerStats{Address: address}
+		p.stats[address] = stats
+	}
+	stats.Shares += 1
+	stats.LastShare = int(time.Now().Unix())
+	return stats
+}
+
+// pruneSeen forgets the solutions of templates that can't be solved
+// anymore.
+func (p *pool) pruneSeen() {
+	for id := range p.seen {
+		if !templates.has(id) {
+			delete(p.seen, id)
+		}
+	}
+}
+
+func (p *pool) windowShares(address string) int {
+	var count int
+	for _, s := range p.window {
+		if s.Address == address {
+			count += 1
+		}
+	}
+	return count
+}
+
+func GetMinerStats(address string) (*MinerStats, error) {
+	if !PoolEnabled() {
+		return nil, errPoolDisabled
+	}
+	pl.m.Lock()
+	defer pl.m.Unlock()
+	stats, ok := pl.stats[address]
+	if !ok {
+		return nil, errors.New("Miner not found")
+	}
+	result := *stats
+	result.WindowShares = pl.windowShares(address)
+	return &result, nil
+}
+
+func GetPoolStats() ([]*MinerStats, error) {
+	if !PoolEnabled() {
+		return nil, errPoolDisabled
+	}
+	pl.m.Lock()
+	defer pl.m.Unlock()
+	var all []*MinerStats
+	for address, stats := range pl.stats {
+		result := *stats
+		result.WindowShares = pl.windowShares(address)
+		all = append(all, &result)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Address < all[j].Address })
+	return all, nil
+}
@@ -0,0 +1,59 @@
+package miner
+
+import (
+	"testing"
+
+	"github.com/fantasticake/simple-coin/blockchain"
+)
+
+func TestSplitReward(t *testing.T) {
+	t.Run("should split in proportion to shares", func(t *testing.T) {
+		window := []share{{Address: "a"}, {Address: "b"}, {Address: "a"}, {Address: "a"}}
+		outs := splitReward(window, 8)
+		if len(outs) != 2 || outs[0].Address != "a" || outs[0].Amount != 6 || outs[1].Amount != 2 {
+			t.Errorf("Expected: a:6 b:2, Got: %v %v", outs[0], outs[1])
+		}
+	})
+	t.Run("should pay the whole value", func(t *testing.T) {
+		window := []share{{Address: "a"}, {Address: "b"}, {Address: "c"}}
+		var total int
+		for _, out := range splitReward(window, 10) {
+			total += out.Amount
+		}
+		if total != 10 {
+			t.Errorf("Expected: 10, Got: %d", total)
+		}
+	})
+	t.Run("should return nothing without shares", func(t *testing.T) {
+		if outs := splitReward(nil, 10); len(outs) != 0 {
+			t.Errorf("Expected no payouts, Got: %d", len(outs))
+		}
+	})
+}
+
+func TestShareDifficulty(t *testing.T) {
+	if d := shareDifficulty(1); d != 1 {
+		t.Errorf("Expected: 1, Got: %d", d)
+	}
+	if d := shareDifficulty(4); d != 4-shareDiffPenalty {
+		t.Errorf("Expected: %d, Got: %d", 4-shareDiffPenalty, d)
+	}
+}
+
+func TestPruneSeen(t *testing.T) {
+	defer func(old *workTemplates) { templates = old }(templates)
+	templates = &workTemplates{v: make(map[string]*issuedTemplate)}
+	templates.add(&blockchain.Block{MerkleRoot: "a"}, "miner")
+	if _, address, _ := templates.get("a"); address != "miner" {
+		t.Errorf("Expected: miner, Got: %s", address)
+	}
+
+	p := &pool{seen: map[string]map[Solution]bool{
+		"a": {{Id: "a"}: true},
+		"b": {{Id: "b"}: true},
+	}}
+	p.pruneSeen()
+	if len(p.seen) != 1 || p.seen["a"] == nil {
+		t.Errorf("Expected only the shares of a, Got: %v", p.seen)
+	}
+}
@@ -0,0 +1,143 @@
+package miner
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fantasticake/simple-coin/blockchain"
+	"github.com/fantasticake/simple-coin/p2p"
+)
+
+// Template is the work handed to an external miner. The block hash is the
+// SHA-256 of the JSON object
+// {prevHash, height, difficulty, nonce, timestamp, merkleRoot, witnessRoot}
+// with the fields in that order, and it must start with difficulty zeros.
+type Template struct {
+	Id            string           `json:"id"`
+	PrevHash      string           `json:"prevHash"`
+	Height        int              `json:"height"`
+	Difficulty    int              `json:"difficulty"`
+	Target        string           `json:"target"`
+	Timestamp     int              `json:"timestamp"`
+	MerkleRoot    string           `json:"merkleRoot"`
+	WitnessRoot   string           `json:"witnessRoot"`
+	CoinbaseValue int              `json:"coinbaseValue"`
+	Transactions  []*blockchain.Tx `json:"transactions"`
+}
+
+type Solution struct {
+	Id        string `json:"id"`
+	Nonce     int    `json:"nonce"`
+	Timestamp int    `json:"timestamp"`
+}
+
+type issuedTemplate struct {
+	block *blockchain.Block
+	// address is the pool miner the template was issued to.
+	address string
+	issued  time.Time
+}
+
+type workTemplates struct {
+	v map[string]*issuedTemplate
+	m sync.Mutex
+}
+
+var (
+	templateTTL  = 10 * time.Minute // how long a template can be solved
+	maxTemplates = 1000             // templates kept at once, oldest dropped first
+
+	errUnknownTemplate = errors.New("Unknown or expired template")
+	errBadSolution     = errors.New("Solution does not meet the target or the template is stale")
+
+	templates = &workTemplates{v: make(map[string]*issuedTemplate)}
+)
+
+func newTemplate(block *blockchain.Block) *Template {
+	return &Template{
+		Id:            block.MerkleRoot,
+		PrevHash:      block.PrevHash,
+		Height:        block.Height,
+		Difficulty:    block.Difficulty,
+		Target:        block.Target(),
+		Timestamp:     block.Timestamp,
+		MerkleRoot:    block.MerkleRoot,
+		WitnessRoot:   block.WitnessRoot,
+		CoinbaseValue: block.CoinbaseValue(),
+		Transactions:  block.Transactions,
+	}
+}
+
+// GetTemplate builds a block template on top of the tip and remembers it
+// until a solution comes back, the tip moves or it expires. A non empty address
+// overrides where the coinbase pays.
+func GetTemplate(address string) *Template {
+	block := blockchain.NewBlockTemplate(blockchain.BC())
+	if address != "" {
+		block.SetCoinbaseOutputs([]*blockchain.TxOut{{Address: address, Amount: block.CoinbaseValue()}})
+	}
+	templates.add(block, "")
+	return newTemplate(block)
+}
+
+// add remembers block issued to address, dropping templates on an old tip,
+// expired ones and the oldest ones past maxTemplates.
+func (t *workTemplates) add(block *blockchain.Block, address string) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	now := time.Now()
+	for id, template := range t.v {
+		if template.block.PrevHash != block.PrevHash || now.Sub(template.issued) > templateTTL {
+			delete(t.v, id)
+		}
+	}
+	for len(t.v) >= maxTemplates {
+		oldest := ""
+		for id, template := range t.v {
+			if oldest == "" || template.issued.Before(t.v[oldest].issued) {
+				oldest = id
+			}
+		}
+		delete(t.v, oldest)
+	}
+	t.v[block.MerkleRoot] = &issuedTemplate{block, address, now}
+}
+
+// get returns the template with id and the address it was issued to.
+func (t *workTemplates) get(id string) (blockchain.Block, string, bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	template, ok := t.v[id]
+	if !ok || time.Since(template.issued) > templateTTL {
+		return blockchain.Block{}, "", false
+	}
+	return *template.block, template.address, true
+}
+
+func (t *workTemplates) has(id string) bool {
+	_, _, ok := t.get(id)
+	return ok
+}
+
+func (t *workTemplates) remove(id string) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	delete(t.v, id)
+}
+
+// SubmitSolution puts a solved nonce on its template, adds the block to the
+// chain and broadcasts it.
+func SubmitSolution(solution *Solution) (*blockchain.Block, error) {
+	block, _, ok := templates.get(solution.Id)
+	if !ok {
+		return nil, errUnknownTemplate
+	}
+	block.SetSolution(solution.Nonce, solution.Timestamp)
+	if blockchain.BC().AddMinedBlock(&block) != nil {
+		return nil, errBadSolution
+	}
+	templates.remove(solution.Id)
+	p2p.BroadcastNewBlock(&block)
+	return &block, nil
+}
@@ -0,0 +1,44 @@
+package miner
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fantasticake/simple-coin/blockchain"
+)
+
+func TestWorkTemplates(t *testing.T) {
+	newTemplates := func() *workTemplates {
+		return &workTemplates{v: make(map[string]*issuedTemplate)}
+	}
+	t.Run("should drop templates on an old tip", func(t *testing.T) {
+		tt := newTemplates()
+		tt.add(&blockchain.Block{PrevHash: "old", MerkleRoot: "a"}, "")
+		tt.add(&blockchain.Block{PrevHash: "new", MerkleRoot: "b"}, "")
+		if _, _, ok := tt.get("a"); ok {
+			t.Error("should forget the template on the old tip")
+		}
+	})
+	t.Run("should expire old templates", func(t *testing.T) {
+		tt := newTemplates()
+		tt.add(&blockchain.Block{MerkleRoot: "a"}, "")
+		tt.v["a"].issued = time.Now().Add(-templateTTL - time.Second)
+		if _, _, ok := tt.get("a"); ok {
+			t.Error("should not hand out an expired template")
+		}
+		tt.add(&blockchain.Block{MerkleRoot: "b"}, "")
+		if _, ok := tt.v["a"]; ok {
+			t.Error("should drop the expired template")
+		}
+	})
+	t.Run("should keep at most maxTemplates", func(t *testing.T) {
+		tt := newTemplates()
+		for i := 0; i <= maxTemplates; i++ {
+			tt.add(&blockchain.Block{MerkleRoot: fmt.Sprint(i)}, "")
+		}
+		if len(tt.v) != maxTemplates {
+			t.Errorf("Expected: %d, Got: %d", maxTemplates, len(tt.v))
+		}
+	})
+}
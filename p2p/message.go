@@ -15,6 +15,7 @@ const (
 	newTxMessage
 	newBlockMessage
 	newPeerMessage
+	statusMessage
 )
 
 type message struct {
@@ -28,6 +29,12 @@ type NewPeerPayload struct {
 	OpenPort int
 }
 
+// StatusPayload tells a peer which blocks we can serve.
+type StatusPayload struct {
+	Pruned       bool
+	PrunedHeight int
+}
+
 func (p *peer) sendMessage(messageType int, payload any) {
 	m := message{messageType, utils.ToJson(payload)}
 	p.inbox <- m
@@ -37,14 +44,38 @@ func (p *peer) SendLastBlock() {
 	p.sendMessage(lastBlockMessage, blockchain.LastBlock(blockchain.BC()))
 }
 
+func (p *peer) sendStatus() {
+	b := blockchain.BC()
+	p.sendMessage(statusMessage, &StatusPayload{
+		Pruned:       blockchain.IsPruned(b),
+		PrunedHeight: blockchain.PrunedHeight(b),
+	})
+}
+
 func (p *peer) requestAllBlocks() {
 	p.sendMessage(reqAllBlocksMessage, nil)
 }
 
+// sendAllBlocks sends the stored blocks from the tip down. A pruned node
+// sends the blocks above its pruned height.
 func (p *peer) sendAllBlocks() {
 	p.sendMessage(allBlocksMessage, blockchain.Blocks(blockchain.BC()))
 }
 
+// validateHistory checks the blocks below our snapshot in the background
+// and catches up with the peer afterwards.
+func validateHistory(blocks []*blockchain.Block) {
+	bc := blockchain.BC()
+	err := bc.ValidateHistory(blocks)
+	if err != nil {
+		fmt.Printf("Snapshot history not validated: %s\n", err)
+		return
+	}
+	if len(blocks) > blockchain.GetHeight(bc) {
+		bc.ReplaceBlocks(blocks)
+	}
+}
+
 func BroadcastNewTx(tx *blockchain.Tx) {
 	Peers().m.Lock()
 	defer Peers().m.Unlock()
@@ -81,8 +112,11 @@ func handleMessage(p *peer, m *message) {
 	case lastBlockMessage:
 		block := blockchain.Block{}
 		utils.FromJson(&block, m.Payload)
-		if block.Height >= blockchain.GetHeight(blockchain.BC()) {
-			p.requestAllBlocks()
+		bc := blockchain.BC()
+		if block.Height >= blockchain.GetHeight(bc) || blockchain.NeedsHistory(bc) {
+			if !p.Pruned {
+				p.requestAllBlocks()
+			}
 		} else {
 			p.sendAllBlocks()
 		}
@@ -91,13 +125,16 @@ func handleMessage(p *peer, m *message) {
 	case allBlocksMessage:
 		blocks := []*blockchain.Block{}
 		utils.FromJson(&blocks, m.Payload)
-		if len(blocks) >= blockchain.GetHeight(blockchain.BC()) {
-			blockchain.BC().ReplaceBlocks(blocks)
+		bc := blockchain.BC()
+		if blockchain.NeedsHistory(bc) {
+			go validateHistory(blocks)
+		} else if len(blocks) >= blockchain.GetHeight(bc) {
+			bc.ReplaceBlocks(blocks)
 		}
 	case newTxMessage:
 		tx := &blockchain.Tx{}
 		utils.FromJson(tx, m.Payload)
-		blockchain.Mempool().Txs[tx.Id] = tx
+		blockchain.Mempool().AddPeerTx(blockchain.BC(), tx)
 	case newBlockMessage:
 		block := &blockchain.Block{}
 		utils.FromJson(block, m.Payload)
@@ -111,5 +148,10 @@ func handleMessage(p *peer, m *message) {
 			utils.HandleErr(err)
 			Peers().InitPeer(conn, payload.Address, payload.Port)
 		}
+	case statusMessage:
+		payload := &StatusPayload{}
+		utils.FromJson(payload, m.Payload)
+		p.Pruned = payload.Pruned
+		p.PrunedHeight = payload.PrunedHeight
 	}
 }
@@ -13,10 +13,12 @@ type peers struct {
 }
 
 type peer struct {
-	Address string `json:"address"`
-	Port    int    `json:"port"`
-	conn    *websocket.Conn
-	inbox   chan message
+	Address      string `json:"address"`
+	Port         int    `json:"port"`
+	Pruned       bool   `json:"pruned"`
+	PrunedHeight int    `json:"prunedHeight"`
+	conn         *websocket.Conn
+	inbox        chan message
 }
 
 var (
@@ -45,6 +47,7 @@ func (p *peers) InitPeer(conn *websocket.Conn, address string, port int) *peer {
 	newPeer := p.addPeer(conn, address, port)
 	go newPeer.read()
 	go newPeer.write()
+	newPeer.sendStatus()
 	return newPeer
 }
 
@@ -1,14 +1,18 @@
 package rest
 
 import (
+	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fantasticake/simple-coin/blockchain"
+	"github.com/fantasticake/simple-coin/miner"
 	"github.com/fantasticake/simple-coin/p2p"
 	"github.com/fantasticake/simple-coin/utils"
 	"github.com/fantasticake/simple-coin/wallet"
@@ -32,13 +36,100 @@ type urlInfo struct {
 }
 
 type totalBalanceResponse struct {
+	Address   string `json:"address"`
+	Amount    int    `json:"amount"`
+	WatchOnly int    `json:"watchOnly"`
+}
+
+type addressResponse struct {
+	Address string `json:"address"`
+}
+
+type walletResponse struct {
+	Name          string         `json:"name"`
+	Address       string         `json:"address"`
+	KeyType       wallet.KeyType `json:"keyType"`
+	Account       string         `json:"account,omitempty"`
+	WatchOnly     bool           `json:"watchOnly"`
+	Encrypted     bool           `json:"encrypted"`
+	Locked        bool           `json:"locked"`
+	UnlockedUntil int64          `json:"unlockedUntil,omitempty"`
+}
+
+type createWalletPayload struct {
+	Name       string `json:"name"`
+	Passphrase string `json:"passphrase"`
+	KeyType    string `json:"keyType"`
+	WatchOnly  bool   `json:"watchOnly"`
+	Account    string `json:"account"`
+}
+
+type createWalletResponse struct {
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Mnemonic string `json:"mnemonic,omitempty"`
+}
+
+type importPayload struct {
 	Address string `json:"address"`
-	Amount  int    `json:"amount"`
+	PubKey  string `json:"pubKey"`
+	KeyType string `json:"keyType"`
+}
+
+type passphrasePayload struct {
+	Passphrase string `json:"passphrase"`
+}
+
+type unlockPayload struct {
+	Passphrase string `json:"passphrase"`
+	Timeout    int    `json:"timeout"`
+}
+
+type changePassphrasePayload struct {
+	OldPassphrase string `json:"oldPassphrase"`
+	NewPassphrase string `json:"newPassphrase"`
 }
 
 type sendPayload struct {
-	To     string `json:"to"`
-	Amount int    `json:"amount"`
+	To       string              `json:"to,omitempty"`
+	Amount   int                 `json:"amount,omitempty"`
+	Outputs  []*blockchain.TxOut `json:"outputs,omitempty"`
+	Strategy string              `json:"strategy,omitempty"`
+}
+
+func (p *sendPayload) outs() []*blockchain.TxOut {
+	if len(p.Outputs) > 0 {
+		return p.Outputs
+	}
+	return []*blockchain.TxOut{{Address: p.To, Amount: p.Amount}}
+}
+
+type htlcPayload struct {
+	Recipient string `json:"recipient"`
+	Hash      string `json:"hash"`
+	Locktime  int    `json:"locktime"`
+	Amount    int    `json:"amount"`
+}
+
+type htlcSpendPayload struct {
+	TxId     string `json:"txId"`
+	Index    int    `json:"index"`
+	Preimage string `json:"preimage,omitempty"`
+}
+
+type preimageResponse struct {
+	Hash     string `json:"hash"`
+	Preimage string `json:"preimage"`
+}
+
+type dataPayload struct {
+	Data     string `json:"data"`
+	Strategy string `json:"strategy,omitempty"`
+}
+
+type signPayload struct {
+	Tx      *blockchain.Tx `json:"tx"`
+	SigHash string         `json:"sigHash,omitempty"`
 }
 
 type connectPayload struct {
@@ -57,6 +148,81 @@ func documentaion(w http.ResponseWriter, r *http.Request) {
 			Method:      "GET",
 			Description: "Get all blocks",
 		},
+		{
+			Url:         URL("/wallet"),
+			Method:      "GET",
+			Description: "See the address of the wallet and whether it is locked",
+		},
+		{
+			Url:         URL("/wallet/addresses"),
+			Method:      "GET",
+			Description: "See the addresses handed out by the wallet",
+		},
+		{
+			Url:         URL("/wallet/addresses"),
+			Method:      "POST",
+			Description: "Get a fresh receive address",
+		},
+		{
+			Url:         URL("/wallet/transactions"),
+			Method:      "GET",
+			Description: "See the transactions paying or spending the wallet, newest first",
+		},
+		{
+			Url:         URL("/wallet/encrypt"),
+			Method:      "POST",
+			Description: "Encrypt the wallet file with a passphrase and lock the wallet",
+			Payload:     "passphrase:string",
+		},
+		{
+			Url:         URL("/wallet/passphrase"),
+			Method:      "POST",
+			Description: "Change the passphrase of an encrypted wallet",
+			Payload:     "oldPassphrase:string, newPassphrase:string",
+		},
+		{
+			Url:         URL("/wallet/unlock"),
+			Method:      "POST",
+			Description: "Unlock an encrypted wallet so it can sign for timeout seconds",
+			Payload:     "passphrase:string, timeout:int",
+		},
+		{
+			Url:         URL("/wallet/lock"),
+			Method:      "POST",
+			Description: "Lock an unlocked wallet right away",
+		},
+		{
+			Url:         URL("/wallet/import"),
+			Method:      "POST",
+			Description: "Watch an address or the address of a public key without its private key",
+			Payload:     "address:string or pubKey:string, keyType:string",
+		},
+		{
+			Url:         URL("/wallets"),
+			Method:      "GET",
+			Description: "See the wallet files of the node and which are loaded",
+		},
+		{
+			Url:         URL("/wallets"),
+			Method:      "POST",
+			Description: "Create a named wallet and load it, a watch-only one from the account key of another wallet or empty",
+			Payload:     "name:string, passphrase:string, keyType:string, watchOnly:bool, account:string",
+		},
+		{
+			Url:         URL("/wallets/{wallet}/load"),
+			Method:      "POST",
+			Description: "Load a named wallet from its file",
+		},
+		{
+			Url:         URL("/wallets/{wallet}/unload"),
+			Method:      "POST",
+			Description: "Unload a named wallet, wiping its keys from memory",
+		},
+		{
+			Url:         URL("/wallets/{wallet}/..."),
+			Method:      "GET, POST",
+			Description: "Every wallet route (/balance, /wallet/..., /send, /data, /transactions/sign, /htlc) for a named wallet, e.g. /wallets/{wallet}/balance or /wallets/{wallet}/transactions",
+		},
 		{
 			Url:         URL("/blocks"),
 			Method:      "POST",
@@ -67,6 +233,106 @@ func documentaion(w http.ResponseWriter, r *http.Request) {
 			Method:      "GET",
 			Description: "get a block by hash",
 		},
+		{
+			Url:         URL("/miner"),
+			Method:      "GET",
+			Description: "See the status of the background miner",
+		},
+		{
+			Url:         URL("/miner/start"),
+			Method:      "POST",
+			Description: "Start mining in the background",
+		},
+		{
+			Url:         URL("/miner/stop"),
+			Method:      "POST",
+			Description: "Stop the background miner",
+		},
+		{
+			Url:         URL("/mining/template?address={address}"),
+			Method:      "GET",
+			Description: "Get a block template for an external miner, optionally paying another address",
+		},
+		{
+			Url:         URL("/mining/submit"),
+			Method:      "POST",
+			Description: "Submit a solved block template",
+			Payload:     "id:string, nonce:int, timestamp:int",
+		},
+		{
+			Url:         URL("/pool/work?address={address}"),
+			Method:      "GET",
+			Description: "Get pool work paying shares to an address",
+		},
+		{
+			Url:         URL("/pool/submit"),
+			Method:      "POST",
+			Description: "Submit a pool share",
+			Payload:     "id:string, nonce:int, timestamp:int",
+		},
+		{
+			Url:         URL("/pool/stats"),
+			Method:      "GET",
+			Description: "See share stats of every pool miner",
+		},
+		{
+			Url:         URL("/pool/stats/{address}"),
+			Method:      "GET",
+			Description: "See share stats of a pool miner",
+		},
+		{
+			Url:         URL("/send"),
+			Method:      "POST",
+			Description: "Send coins to one address or to a list of outputs",
+			Payload:     "to:string, amount:int or outputs:[{address:string, amount:int}], strategy:string",
+		},
+		{
+			Url:         URL("/send/estimate"),
+			Method:      "POST",
+			Description: "Estimate the fee of a send",
+			Payload:     "same as /send",
+		},
+		{
+			Url:         URL("/data"),
+			Method:      "POST",
+			Description: "Anchor hex encoded data in a transaction",
+			Payload:     "data:string, strategy:string",
+		},
+		{
+			Url:         URL("/transactions/sign"),
+			Method:      "POST",
+			Description: "Sign the wallet's inputs of a transaction",
+			Payload:     "tx:object, sigHash:string (ALL, NONE, SINGLE, optionally |ANYONECANPAY)",
+		},
+		{
+			Url:         URL("/transactions"),
+			Method:      "POST",
+			Description: "Submit a signed transaction",
+			Payload:     "tx:object",
+		},
+		{
+			Url:         URL("/htlc"),
+			Method:      "POST",
+			Description: "Lock coins in a hash time-locked contract",
+			Payload:     "recipient:string, hash:string, locktime:int, amount:int",
+		},
+		{
+			Url:         URL("/htlc/claim"),
+			Method:      "POST",
+			Description: "Claim an HTLC by revealing its preimage",
+			Payload:     "txId:string, index:int, preimage:string",
+		},
+		{
+			Url:         URL("/htlc/refund"),
+			Method:      "POST",
+			Description: "Refund an expired HTLC",
+			Payload:     "txId:string, index:int",
+		},
+		{
+			Url:         URL("/htlc/{hash}/preimage"),
+			Method:      "GET",
+			Description: "Get a preimage revealed on chain",
+		},
 	}
 
 	utils.HandleErr(json.NewEncoder(w).Encode(urlData))
@@ -77,27 +343,250 @@ func balance(w http.ResponseWriter, r *http.Request) {
 	encoder := json.NewEncoder(w)
 	switch isTotal {
 	case "true":
+		amount, watchOnly := blockchain.GetWalletBalance(blockchain.BC(), walletOf(r))
 		utils.HandleErr(encoder.Encode(totalBalanceResponse{
-			Address: wallet.Wallet().Address,
-			Amount:  blockchain.GetBalanceByAddr(blockchain.BC(), wallet.Wallet().Address),
+			Address:   walletOf(r).Address,
+			Amount:    amount,
+			WatchOnly: watchOnly,
 		}))
 	default:
-		utils.HandleErr(encoder.Encode(blockchain.GetUTxOutsByAddr(blockchain.BC(), wallet.Wallet().Address)))
+		utils.HandleErr(encoder.Encode(blockchain.GetWalletUTxOuts(blockchain.BC(), walletOf(r))))
+	}
+}
+
+func walletStatus(wl *wallet.W) walletResponse {
+	response := walletResponse{
+		Name:      wl.Name,
+		Address:   wl.Address,
+		KeyType:   wallet.KeyTypeOf(wl),
+		Account:   wallet.AccountKey(wl),
+		WatchOnly: wallet.IsWatchOnly(wl),
+		Encrypted: wallet.IsEncrypted(wl),
+		Locked:    wallet.IsLocked(wl),
+	}
+	if until := wallet.UnlockedUntil(wl); !until.IsZero() {
+		response.UnlockedUntil = until.Unix()
+	}
+	return response
+}
+
+func walletInfo(w http.ResponseWriter, r *http.Request) {
+	utils.HandleErr(json.NewEncoder(w).Encode(walletStatus(walletOf(r))))
+}
+
+func walletAddresses(w http.ResponseWriter, r *http.Request) {
+	utils.HandleErr(json.NewEncoder(w).Encode(wallet.Addresses(walletOf(r))))
+}
+
+func walletTransactions(w http.ResponseWriter, r *http.Request) {
+	history, err := blockchain.GetWalletHistory(walletOf(r))
+	writeResult(w, history, err)
+}
+
+func newAddress(w http.ResponseWriter, r *http.Request) {
+	address, err := wallet.NewAddress(walletOf(r))
+	writeResult(w, addressResponse{address}, err)
+}
+
+func importAddress(w http.ResponseWriter, r *http.Request) {
+	var payload importPayload
+	utils.HandleErr(json.NewDecoder(r.Body).Decode(&payload))
+	if payload.PubKey == "" {
+		err := wallet.ImportAddress(walletOf(r), payload.Address)
+		writeResult(w, addressResponse{payload.Address}, err)
+		return
+	}
+	if payload.KeyType == "" {
+		payload.KeyType = wallet.P256.String()
 	}
+	keyType, err := wallet.ParseKeyType(payload.KeyType)
+	var address string
+	if err == nil {
+		address, err = wallet.ImportPubKey(walletOf(r), payload.PubKey, keyType)
+	}
+	writeResult(w, addressResponse{address}, err)
+}
+
+func encryptWallet(w http.ResponseWriter, r *http.Request) {
+	var payload passphrasePayload
+	utils.HandleErr(json.NewDecoder(r.Body).Decode(&payload))
+	err := wallet.Encrypt(walletOf(r), payload.Passphrase)
+	writeResult(w, walletStatus(walletOf(r)), err)
+}
+
+func changePassphrase(w http.ResponseWriter, r *http.Request) {
+	var payload changePassphrasePayload
+	utils.HandleErr(json.NewDecoder(r.Body).Decode(&payload))
+	err := wallet.ChangePassphrase(walletOf(r), payload.OldPassphrase, payload.NewPassphrase)
+	writeResult(w, walletStatus(walletOf(r)), err)
+}
+
+func unlockWallet(w http.ResponseWriter, r *http.Request) {
+	var payload unlockPayload
+	utils.HandleErr(json.NewDecoder(r.Body).Decode(&payload))
+	err := wallet.Unlock(walletOf(r), payload.Passphrase, time.Duration(payload.Timeout)*time.Second)
+	writeResult(w, walletStatus(walletOf(r)), err)
+}
+
+func lockWallet(w http.ResponseWriter, r *http.Request) {
+	err := wallet.Lock(walletOf(r))
+	writeResult(w, walletStatus(walletOf(r)), err)
+}
+
+func wallets(w http.ResponseWriter, r *http.Request) {
+	infos, err := wallet.List()
+	writeResult(w, infos, err)
+}
+
+func createWallet(w http.ResponseWriter, r *http.Request) {
+	var payload createWalletPayload
+	utils.HandleErr(json.NewDecoder(r.Body).Decode(&payload))
+	if payload.KeyType == "" {
+		payload.KeyType = wallet.P256.String()
+	}
+	keyType, err := wallet.ParseKeyType(payload.KeyType)
+	if err != nil {
+		writeResult(w, nil, err)
+		return
+	}
+	var created *wallet.W
+	var mnemonic string
+	if payload.WatchOnly {
+		created, err = wallet.CreateWatchOnly(payload.Name, payload.Account, keyType)
+	} else {
+		created, mnemonic, err = wallet.Create(payload.Name, payload.Passphrase, keyType)
+	}
+	if err != nil {
+		writeResult(w, nil, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	utils.HandleErr(json.NewEncoder(w).Encode(createWalletResponse{created.Name, created.Address, mnemonic}))
+}
+
+func loadWallet(w http.ResponseWriter, r *http.Request) {
+	loaded, err := wallet.Load(mux.Vars(r)["wallet"])
+	if err == nil {
+		// Blocks that arrived while it was unloaded may pay past its window.
+		_, err = blockchain.RescanWallet(loaded)
+	}
+	if err != nil {
+		writeResult(w, nil, err)
+		return
+	}
+	writeResult(w, walletStatus(loaded), nil)
+}
+
+func unloadWallet(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["wallet"]
+	writeResult(w, wallet.WalletInfo{Name: name}, wallet.Unload(name))
+}
+
+// validateOptionalAddress checks an address an endpoint can do without.
+func validateOptionalAddress(address string) error {
+	if address == "" {
+		return nil
+	}
+	return wallet.ValidateAddress(address)
 }
 
 func send(w http.ResponseWriter, r *http.Request) {
 	var payload sendPayload
 	utils.HandleErr(json.NewDecoder(r.Body).Decode(&payload))
-	tx, err := blockchain.Mempool().AddTx(blockchain.BC(), payload.To, payload.Amount)
+	tx, err := blockchain.Mempool().AddTx(blockchain.BC(), walletOf(r), payload.outs(), payload.Strategy)
+	writeTx(w, tx, err)
+}
+
+func estimateFee(w http.ResponseWriter, r *http.Request) {
+	var payload sendPayload
+	utils.HandleErr(json.NewDecoder(r.Body).Decode(&payload))
+	estimate, err := blockchain.EstimateFee(blockchain.BC(), walletOf(r), payload.outs(), payload.Strategy)
+	encoder := json.NewEncoder(w)
 	if err != nil {
-		json.NewEncoder(w).Encode(errorResponse{fmt.Sprint(err)})
+		utils.HandleErr(encoder.Encode(errorResponse{fmt.Sprint(err)}))
+	} else {
+		utils.HandleErr(encoder.Encode(estimate))
+	}
+}
+
+func writeTx(w http.ResponseWriter, tx *blockchain.Tx, err error) {
+	encoder := json.NewEncoder(w)
+	if err != nil {
+		utils.HandleErr(encoder.Encode(errorResponse{fmt.Sprint(err)}))
 	} else {
 		w.WriteHeader(http.StatusCreated)
+		utils.HandleErr(encoder.Encode(tx))
 		p2p.BroadcastNewTx(tx)
 	}
 }
 
+func data(w http.ResponseWriter, r *http.Request) {
+	var payload dataPayload
+	utils.HandleErr(json.NewDecoder(r.Body).Decode(&payload))
+	data, err := hex.DecodeString(payload.Data)
+	var tx *blockchain.Tx
+	if err == nil {
+		tx, err = blockchain.Mempool().AddData(blockchain.BC(), walletOf(r), data, payload.Strategy)
+	}
+	writeTx(w, tx, err)
+}
+
+func signTx(w http.ResponseWriter, r *http.Request) {
+	var payload signPayload
+	utils.HandleErr(json.NewDecoder(r.Body).Decode(&payload))
+	encoder := json.NewEncoder(w)
+	sigHash, err := blockchain.ParseSigHash(payload.SigHash)
+	if err == nil {
+		_, err = blockchain.SignTx(blockchain.BC(), walletOf(r), payload.Tx, sigHash)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.HandleErr(encoder.Encode(errorResponse{fmt.Sprint(err)}))
+	} else {
+		utils.HandleErr(encoder.Encode(payload.Tx))
+	}
+}
+
+func submitTx(w http.ResponseWriter, r *http.Request) {
+	tx := &blockchain.Tx{}
+	utils.HandleErr(json.NewDecoder(r.Body).Decode(tx))
+	tx, err := blockchain.Mempool().SubmitTx(blockchain.BC(), tx)
+	writeTx(w, tx, err)
+}
+
+func htlc(w http.ResponseWriter, r *http.Request) {
+	var payload htlcPayload
+	utils.HandleErr(json.NewDecoder(r.Body).Decode(&payload))
+	tx, err := blockchain.Mempool().AddHTLC(blockchain.BC(), walletOf(r), payload.Recipient, payload.Hash, payload.Locktime, payload.Amount)
+	writeTx(w, tx, err)
+}
+
+func claimHTLC(w http.ResponseWriter, r *http.Request) {
+	var payload htlcSpendPayload
+	utils.HandleErr(json.NewDecoder(r.Body).Decode(&payload))
+	tx, err := blockchain.Mempool().ClaimHTLC(blockchain.BC(), walletOf(r), payload.TxId, payload.Index, payload.Preimage)
+	writeTx(w, tx, err)
+}
+
+func refundHTLC(w http.ResponseWriter, r *http.Request) {
+	var payload htlcSpendPayload
+	utils.HandleErr(json.NewDecoder(r.Body).Decode(&payload))
+	tx, err := blockchain.Mempool().RefundHTLC(blockchain.BC(), walletOf(r), payload.TxId, payload.Index)
+	writeTx(w, tx, err)
+}
+
+func preimage(w http.ResponseWriter, r *http.Request) {
+	hash := mux.Vars(r)["hash"]
+	preimage, err := blockchain.FindPreimage(blockchain.BC(), hash)
+	encoder := json.NewEncoder(w)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		utils.HandleErr(encoder.Encode(errorResponse{fmt.Sprint(err)}))
+	} else {
+		utils.HandleErr(encoder.Encode(preimageResponse{hash, preimage}))
+	}
+}
+
 func mempool(w http.ResponseWriter, r *http.Request) {
 	utils.HandleErr(json.NewEncoder(w).Encode(blockchain.MemPoolTxs(blockchain.Mempool())))
 }
@@ -126,6 +615,93 @@ func block(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func minerStatus(w http.ResponseWriter, r *http.Request) {
+	utils.HandleErr(json.NewEncoder(w).Encode(miner.GetStatus(miner.Miner())))
+}
+
+func startMiner(w http.ResponseWriter, r *http.Request) {
+	writeMinerStatus(w, miner.Miner().Start())
+}
+
+func stopMiner(w http.ResponseWriter, r *http.Request) {
+	writeMinerStatus(w, miner.Miner().Stop())
+}
+
+func writeMinerStatus(w http.ResponseWriter, err error) {
+	encoder := json.NewEncoder(w)
+	if err != nil {
+		w.WriteHeader(http.StatusConflict)
+		utils.HandleErr(encoder.Encode(errorResponse{fmt.Sprint(err)}))
+	} else {
+		utils.HandleErr(encoder.Encode(miner.GetStatus(miner.Miner())))
+	}
+}
+
+func blockTemplate(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if err := validateOptionalAddress(address); err != nil {
+		writeResult(w, nil, err)
+		return
+	}
+	utils.HandleErr(json.NewEncoder(w).Encode(miner.GetTemplate(address)))
+}
+
+func submitBlock(w http.ResponseWriter, r *http.Request) {
+	var solution miner.Solution
+	utils.HandleErr(json.NewDecoder(r.Body).Decode(&solution))
+	block, err := miner.SubmitSolution(&solution)
+	encoder := json.NewEncoder(w)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.HandleErr(encoder.Encode(errorResponse{fmt.Sprint(err)}))
+	} else {
+		w.WriteHeader(http.StatusCreated)
+		utils.HandleErr(encoder.Encode(block))
+	}
+}
+
+func writeResult(w http.ResponseWriter, v any, err error) {
+	encoder := json.NewEncoder(w)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		utils.HandleErr(encoder.Encode(errorResponse{fmt.Sprint(err)}))
+	} else {
+		utils.HandleErr(encoder.Encode(v))
+	}
+}
+
+func poolWork(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if err := validateOptionalAddress(address); err != nil {
+		writeResult(w, nil, err)
+		return
+	}
+	template, err := miner.GetPoolTemplate(address)
+	writeResult(w, template, err)
+}
+
+func poolSubmit(w http.ResponseWriter, r *http.Request) {
+	var solution miner.Solution
+	utils.HandleErr(json.NewDecoder(r.Body).Decode(&solution))
+	stats, err := miner.SubmitShare(&solution)
+	writeResult(w, stats, err)
+}
+
+func poolStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := miner.GetPoolStats()
+	writeResult(w, stats, err)
+}
+
+func poolMinerStats(w http.ResponseWriter, r *http.Request) {
+	address := mux.Vars(r)["address"]
+	if err := wallet.ValidateAddress(address); err != nil {
+		writeResult(w, nil, err)
+		return
+	}
+	stats, err := miner.GetMinerStats(address)
+	writeResult(w, stats, err)
+}
+
 func peers(w http.ResponseWriter, r *http.Request) {
 	utils.HandleErr(json.NewEncoder(w).Encode(p2p.GetPeers()))
 }
@@ -162,16 +738,84 @@ func jsonMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+type walletKey struct{}
+
+// withWallet serves next with the loaded wallet the path names.
+func withWallet(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wl, err := wallet.Get(mux.Vars(r)["wallet"])
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			utils.HandleErr(json.NewEncoder(w).Encode(errorResponse{fmt.Sprint(err)}))
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), walletKey{}, wl)))
+	}
+}
+
+// walletOf is the wallet a request acts for, the default one unless the
+// path names another.
+func walletOf(r *http.Request) *wallet.W {
+	if wl, ok := r.Context().Value(walletKey{}).(*wallet.W); ok {
+		return wl
+	}
+	return wallet.Wallet()
+}
+
+// walletRoutes act for one wallet. Each is served at its path for the
+// default wallet and under /wallets/{wallet} for a named one.
+var walletRoutes = []struct {
+	path    string
+	method  string
+	handler http.HandlerFunc
+}{
+	{"/balance", "GET", balance},
+	{"/wallet", "GET", walletInfo},
+	{"/wallet/addresses", "GET", walletAddresses},
+	{"/wallet/addresses", "POST", newAddress},
+	{"/wallet/transactions", "GET", walletTransactions},
+	{"/wallet/import", "POST", importAddress},
+	{"/wallet/encrypt", "POST", encryptWallet},
+	{"/wallet/passphrase", "POST", changePassphrase},
+	{"/wallet/unlock", "POST", unlockWallet},
+	{"/wallet/lock", "POST", lockWallet},
+	{"/send", "POST", send},
+	{"/send/estimate", "POST", estimateFee},
+	{"/data", "POST", data},
+	{"/transactions/sign", "POST", signTx},
+	{"/htlc", "POST", htlc},
+	{"/htlc/claim", "POST", claimHTLC},
+	{"/htlc/refund", "POST", refundHTLC},
+}
+
 func Start(aPort int) {
 	port = aPort
 	router := mux.NewRouter()
 	router.Use(jsonMiddleware)
 	router.HandleFunc("/", documentaion).Methods("GET")
-	router.HandleFunc("/balance", balance).Methods("GET")
-	router.HandleFunc("/send", send).Methods("POST")
+	for _, route := range walletRoutes {
+		router.HandleFunc(route.path, route.handler).Methods(route.method)
+		named := "/wallets/{wallet}" + strings.TrimPrefix(route.path, "/wallet")
+		router.HandleFunc(named, withWallet(route.handler)).Methods(route.method)
+	}
+	router.HandleFunc("/wallets", wallets).Methods("GET")
+	router.HandleFunc("/wallets", createWallet).Methods("POST")
+	router.HandleFunc("/wallets/{wallet}/load", loadWallet).Methods("POST")
+	router.HandleFunc("/wallets/{wallet}/unload", unloadWallet).Methods("POST")
+	router.HandleFunc("/transactions", submitTx).Methods("POST")
+	router.HandleFunc("/htlc/{hash:[a-f0-9]+}/preimage", preimage).Methods("GET")
 	router.HandleFunc("/mempool", mempool).Methods("GET")
 	router.HandleFunc("/blocks", blocks).Methods("GET", "POST")
 	router.HandleFunc("/blocks/{hash:[a-f0-9]+}", block).Methods("GET")
+	router.HandleFunc("/miner", minerStatus).Methods("GET")
+	router.HandleFunc("/miner/start", startMiner).Methods("POST")
+	router.HandleFunc("/miner/stop", stopMiner).Methods("POST")
+	router.HandleFunc("/mining/template", blockTemplate).Methods("GET")
+	router.HandleFunc("/mining/submit", submitBlock).Methods("POST")
+	router.HandleFunc("/pool/work", poolWork).Methods("GET")
+	router.HandleFunc("/pool/submit", poolSubmit).Methods("POST")
+	router.HandleFunc("/pool/stats", poolStats).Methods("GET")
+	router.HandleFunc("/pool/stats/{address}", poolMinerStats).Methods("GET")
 	router.HandleFunc("/peers", peers).Methods("GET")
 	router.HandleFunc("/ws", ws).Methods("GET")
 	router.HandleFunc("/connect", connect).Methods("POST")
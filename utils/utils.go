@@ -21,7 +21,13 @@ func ToBytes(v any) []byte {
 }
 
 func FromBytes(v any, b []byte) {
-	HandleErr(gob.NewDecoder(bytes.NewReader(b)).Decode(v))
+	HandleErr(DecodeBytes(v, b))
+}
+
+// DecodeBytes is FromBytes for data that may be corrupt, returning the
+// error instead of panicking.
+func DecodeBytes(v any, b []byte) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
 }
 
 func Hash(v any) string {
@@ -29,6 +35,13 @@ func Hash(v any) string {
 	return fmt.Sprintf("%x", hash)
 }
 
+// HashJson hashes the JSON encoding of v, so the result does not depend on
+// pointers or Go formatting.
+func HashJson(v any) string {
+	hash := sha256.Sum256(ToJson(v))
+	return fmt.Sprintf("%x", hash)
+}
+
 func ToJson(v any) []byte {
 	b, err := json.Marshal(v)
 	HandleErr(err)
@@ -30,6 +30,18 @@ func TestHash(t *testing.T) {
 	}
 }
 
+func TestHashJson(t *testing.T) {
+	type test struct {
+		Key *string
+	}
+	v1, v2 := "data", "data"
+	h1 := HashJson(test{&v1})
+	h2 := HashJson(test{&v2})
+	if h1 != h2 {
+		t.Errorf("should hash values behind pointers, Hash1: %v, Hash2: %v", h1, h2)
+	}
+}
+
 func TestToJson(t *testing.T) {
 	type test struct {
 		Key string
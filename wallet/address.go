@@ -0,0 +1,188 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+)
+
+// Addresses are Base58Check encoded: a version byte, the first 20 bytes of
+// the SHA-256 of the compressed public key and a 4 byte checksum. The
+// version byte is the one of the network plus the key type. Spenders
+// reveal the public key next to their signature.
+const pubKeyHashSize = 20
+
+var (
+	addressVersion byte = 0x3f
+
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+	errBadAddress   = errors.New("Invalid address")
+	errWrongNetwork = errors.New("Address belongs to another network")
+)
+
+// SetAddressVersion sets the version byte of the network addresses are for.
+func SetAddressVersion(version byte) {
+	addressVersion = version
+}
+
+func checksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+func base58Encode(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	base := big.NewInt(58)
+	mod := new(big.Int)
+	var encoded []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		encoded = append(encoded, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, base58Alphabet[0])
+	}
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	base := big.NewInt(58)
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	for _, c := range []byte(s) {
+		digit := bytes.IndexByte([]byte(base58Alphabet), c)
+		if digit < 0 {
+			return nil, errBadAddress
+		}
+		n.Mul(n, base)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+func pubKeyHash(pubKey []byte) []byte {
+	sum := sha256.Sum256(pubKey)
+	return sum[:pubKeyHashSize]
+}
+
+// encodeAddress is the address of a public key of type t.
+func encodeAddress(t KeyType, pubKey []byte) string {
+	payload := append([]byte{addressVersion + byte(t)}, pubKeyHash(pubKey)...)
+	return base58Encode(append(payload, checksum(payload)...))
+}
+
+// decodeAddress returns the key type and public key hash address commits
+// to.
+func decodeAddress(address string) (KeyType, []byte, error) {
+	data, err := base58Decode(address)
+	if err != nil || len(data) != 1+pubKeyHashSize+4 {
+		return 0, nil, errBadAddress
+	}
+	payload := data[:1+pubKeyHashSize]
+	if !bytes.Equal(checksum(payload), data[1+pubKeyHashSize:]) {
+		return 0, nil, errBadAddress
+	}
+	keyType := KeyType(payload[0] - addressVersion)
+	if int(keyType) >= len(schemes) {
+		return 0, nil, errWrongNetwork
+	}
+	return keyType, payload[1:], nil
+}
+
+// ValidateAddress checks the encoding, checksum and network of address.
+func ValidateAddress(address string) error {
+	_, _, err := decodeAddress(address)
+	return err
+}
+
+// legacyAddressOf is the hex of X||Y of a P-256 key that served as address
+// before addresses were hashed. Outputs paying it are spent without a
+// public key.
+func legacyAddressOf(pubKey []byte) string {
+	x, y, _ := parseP256Key(pubKey)
+	return hex.EncodeToString(append(x.Bytes(), y.Bytes()...))
+}
+
+// Verify checks signature of hash by the owner of address with the scheme
+// the address names. pubKey is the public key the spender revealed, empty
+// for legacy addresses.
+func Verify(address, pubKey, hash, signature string) bool {
+	if pubKey == "" {
+		return verifyLegacy(address, hash, signature)
+	}
+	keyType, keyHash, err := decodeAddress(address)
+	if err != nil {
+		return false
+	}
+	pubKeyAsB, ok := decodeHex(pubKey)
+	if !ok || !bytes.Equal(keyHash, pubKeyHash(pubKeyAsB)) {
+		return false
+	}
+	signatureAsB, ok := decodeHex(signature)
+	return ok && schemes[keyType].verify(pubKeyAsB, messageDigest(hash), signatureAsB)
+}
+
+// verifyLegacy checks a canonical signature spending a legacy P-256
+// address.
+func verifyLegacy(address, hash, signature string) bool {
+	x, y, ok := parseLegacyKey(address)
+	if !ok {
+		return false
+	}
+	signatureAsB, ok := decodeHex(signature)
+	if !ok {
+		return false
+	}
+	r, s, ok := parseSignature(signatureAsB)
+	return ok && ecdsa.Verify(&ecdsa.PublicKey{Curve: ec, X: x, Y: y}, messageDigest(hash), r, s)
+}
+
+// decodeHex reads lower case hex, the only encoding of signatures and keys
+// accepted.
+func decodeHex(s string) ([]byte, bool) {
+	data, err := hex.DecodeString(s)
+	if err != nil || hex.EncodeToString(data) != s {
+		return nil, false
+	}
+	return data, true
+}
+
+func parseP256Key(pubKey []byte) (*big.Int, *big.Int, bool) {
+	x, y := elliptic.UnmarshalCompressed(ec, pubKey)
+	return x, y, x != nil
+}
+
+func parseLegacyKey(address string) (*big.Int, *big.Int, bool) {
+	x, y, ok := splitHex(address)
+	if !ok || !ec.IsOnCurve(x, y) {
+		return nil, nil, false
+	}
+	return x, y, true
+}
+
+// splitHex reads two numbers from the halves of a hex string, the way
+// legacy addresses and signatures were encoded.
+func splitHex(data string) (*big.Int, *big.Int, bool) {
+	dataAsB, err := hex.DecodeString(data)
+	if err != nil || len(dataAsB) == 0 {
+		return nil, nil, false
+	}
+	x := new(big.Int).SetBytes(dataAsB[:len(dataAsB)/2])
+	y := new(big.Int).SetBytes(dataAsB[len(dataAsB)/2:])
+	return x, y, true
+}
@@ -0,0 +1,80 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fantasticake/simple-coin/utils"
+)
+
+func TestBase58(t *testing.T) {
+	data, _ := hex.DecodeString("00010966776006953d5567439e5e39f86a0d273beed61967f6")
+	encoded := base58Encode(data)
+	if encoded != "16UwLL9Risc3QfPqBUvKofHmBQ7wMtjvM" {
+		t.Errorf("Expected: 16UwLL9Risc3QfPqBUvKofHmBQ7wMtjvM, Got: %s", encoded)
+	}
+	decoded, err := base58Decode(encoded)
+	if err != nil || hex.EncodeToString(decoded) != hex.EncodeToString(data) {
+		t.Errorf("should decode back to %x, Got: %x %v", data, decoded, err)
+	}
+	if _, err := base58Decode("0OIl"); err != errBadAddress {
+		t.Errorf("Expected: %v, Got: %v", errBadAddress, err)
+	}
+}
+
+func TestValidateAddress(t *testing.T) {
+	address := getTestWallet().Address
+	if err := ValidateAddress(address); err != nil {
+		t.Errorf("Expected: nil, Got: %v", err)
+	}
+	typo := "2"
+	if address[5] == '2' {
+		typo = "3"
+	}
+	flipped := address[:5] + typo + address[6:]
+	for _, bad := range []string{"", "to", flipped, legacyAddressOf(testPubKey())} {
+		if err := ValidateAddress(bad); err != errBadAddress {
+			t.Errorf("%s, Expected: %v, Got: %v", bad, errBadAddress, err)
+		}
+	}
+	SetAddressVersion(0x7f)
+	defer SetAddressVersion(0x3f)
+	if err := ValidateAddress(address); err != errWrongNetwork {
+		t.Errorf("Expected: %v, Got: %v", errWrongNetwork, err)
+	}
+}
+
+func TestVerifyAddress(t *testing.T) {
+	key := testKey()
+	signature := hex.EncodeToString(encodeSignature(signDigest(key, messageDigest("test"))))
+	pubKey := hex.EncodeToString(testPubKey())
+
+	if !Verify(importedAddress(), pubKey, "test", signature) {
+		t.Error("should verify with the revealed public key")
+	}
+	if Verify(getTestWallet().Address, pubKey, "test", signature) {
+		t.Error("should reject a public key not matching the address")
+	}
+	if Verify(importedAddress(), pubKey, "test", strings.ToUpper(signature)) {
+		t.Error("should only accept lower case hex")
+	}
+	if !Verify(legacyAddressOf(testPubKey()), "", "test", signature) {
+		t.Error("should verify legacy addresses without a public key")
+	}
+	if Verify(importedAddress(), "", "test", signature) || Verify("zz", "", "test", "zz") {
+		t.Error("should reject malformed input without panicking")
+	}
+
+	r, s, _ := ecdsa.Sign(rand.Reader, key, utils.ToBytes("test"))
+	old := fmt.Sprintf("%x", append(r.Bytes(), s.Bytes()...))
+	if Verify(legacyAddressOf(testPubKey()), "", "test", old) {
+		t.Error("should require canonical signatures on legacy addresses")
+	}
+	if Verify(importedAddress(), pubKey, "test", old) {
+		t.Error("should require canonical signatures with a public key")
+	}
+}
@@ -0,0 +1,343 @@
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fantasticake/simple-coin/utils"
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptedKey is sealed data of an encrypted wallet: AES-GCM under a key
+// derived from the passphrase with scrypt. Address is only set by single
+// key wallets, which sealed their DER key bound to it.
+type encryptedKey struct {
+	Address    string `json:"address,omitempty"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+var (
+	scryptN int = 1 << 15
+	scryptR int = 8
+	scryptP int = 1
+
+	errLocked           = errors.New("Wallet is locked")
+	errWrongPassphrase  = errors.New("Wrong passphrase")
+	errEmptyPassphrase  = errors.New("Passphrase can't be empty")
+	errNotEncrypted     = errors.New("Wallet is not encrypted")
+	errAlreadyEncrypted = errors.New("Wallet is already encrypted")
+	errBadTimeout       = errors.New("Unlock timeout must be positive")
+	errBadSecret        = errors.New("Wallet secret should be a JSON string")
+	errUnknownAddress   = errors.New("Address does not belong to the wallet")
+)
+
+func newGCM(passphrase string, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext bound to aad.
+func seal(plaintext []byte, aad string, passphrase string) (*encryptedKey, error) {
+	if passphrase == "" {
+		return nil, errEmptyPassphrase
+	}
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	utils.HandleErr(err)
+	gcm, err := newGCM(passphrase, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	utils.HandleErr(err)
+	return &encryptedKey{
+		N:          scryptN,
+		R:          scryptR,
+		P:          scryptP,
+		Salt:       hex.EncodeToString(salt),
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(gcm.Seal(nil, nonce, plaintext, []byte(aad))),
+	}, nil
+}
+
+func (e *encryptedKey) open(passphrase string, aad string) ([]byte, error) {
+	salt, err := hex.DecodeString(e.Salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(e.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := hex.DecodeString(e.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(passphrase, salt, e.N, e.R, e.P)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errWrongPassphrase
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(aad))
+	if err != nil {
+		return nil, errWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+// parseEncryptedKey reads the file of an encrypted single key wallet,
+// the only JSON wallet file with an address at its top.
+func parseEncryptedKey(data []byte) (*encryptedKey, bool) {
+	e := &encryptedKey{}
+	if json.Unmarshal(data, e) != nil || e.Address == "" {
+		return nil, false
+	}
+	return e, true
+}
+
+func zeroBytes(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
+
+// secret is text of a wallet file kept as bytes rather than a string, so
+// it can be wiped. It is only ever hex or mnemonic words, which need no
+// escaping in JSON.
+type secret []byte
+
+func (s secret) MarshalJSON() ([]byte, error) {
+	data := make([]byte, 0, len(s)+2)
+	data = append(data, '"')
+	data = append(data, s...)
+	return append(data, '"'), nil
+}
+
+func (s *secret) UnmarshalJSON(data []byte) error {
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return errBadSecret
+	}
+	*s = append(secret{}, data[1:len(data)-1]...)
+	return nil
+}
+
+// decodeHex reads the bytes a hex secret holds.
+func (s secret) decodeHex() ([]byte, error) {
+	data := make([]byte, hex.DecodedLen(len(s)))
+	if _, err := hex.Decode(data, s); err != nil {
+		zeroBytes(data)
+		return nil, err
+	}
+	return data, nil
+}
+
+func hexSecret(data []byte) secret {
+	s := make(secret, hex.EncodedLen(len(data)))
+	hex.Encode(s, data)
+	return s
+}
+
+// wipe zeroes the decrypted secrets.
+func (s *secrets) wipe() {
+	if s == nil {
+		return
+	}
+	zeroBytes(s.Mnemonic)
+	zeroBytes(s.Seed)
+	for _, key := range s.Keys {
+		zeroBytes(key)
+	}
+}
+
+// zeroKey wipes the private scalar of key.
+func zeroKey(key *ecdsa.PrivateKey) {
+	if key == nil {
+		return
+	}
+	words := key.D.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	key.D.SetInt64(0)
+}
+
+func IsEncrypted(w *W) bool {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.data.Encrypted != nil || w.legacy != nil
+}
+
+// UnlockedUntil is when an unlocked wallet locks itself again, zero while
+// it is locked.
+func UnlockedUntil(w *W) time.Time {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.unlockedUntil
+}
+
+func IsLocked(w *W) bool {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.signer == nil
+}
+
+// Encrypt encrypts the wallet file with passphrase and locks the wallet.
+func Encrypt(w *W, passphrase string) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.data.Encrypted != nil || w.legacy != nil {
+		return errAlreadyEncrypted
+	}
+	if w.data.WatchOnly {
+		return errWatchOnly
+	}
+	if err := w.seal(w.data.Secrets, passphrase); err != nil {
+		return err
+	}
+	w.lock()
+	return nil
+}
+
+// ChangePassphrase re-encrypts the wallet file under a new passphrase.
+func ChangePassphrase(w *W, oldPassphrase string, newPassphrase string) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.data.Encrypted == nil && w.legacy == nil {
+		return errNotEncrypted
+	}
+	if newPassphrase == "" {
+		return errEmptyPassphrase
+	}
+	s, err := w.openSecrets(oldPassphrase)
+	if err != nil {
+		return err
+	}
+	defer s.wipe()
+	return w.seal(s, newPassphrase)
+}
+
+// Unlock decrypts the secrets and keys so the wallet can sign for timeout.
+// They are wiped from memory once it expires.
+func Unlock(w *W, passphrase string, timeout time.Duration) error {
+	if timeout <= 0 {
+		return errBadTimeout
+	}
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.data.Encrypted == nil && w.legacy == nil {
+		return errNotEncrypted
+	}
+	s, err := w.openSecrets(passphrase)
+	if err != nil {
+		return err
+	}
+	w.lock()
+	if err := w.unlockSecrets(s); err != nil {
+		s.wipe()
+		return err
+	}
+	w.unlockedUntil = time.Now().Add(timeout)
+	unlockId := w.unlockId
+	w.lockTimer = time.AfterFunc(timeout, func() {
+		w.m.Lock()
+		defer w.m.Unlock()
+		// A later unlock or lock owns the keys now.
+		if w.unlockId == unlockId {
+			w.lock()
+		}
+	})
+	return nil
+}
+
+// Lock wipes the decrypted secrets and keys of an encrypted wallet right
+// away.
+func Lock(w *W) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.data.Encrypted == nil && w.legacy == nil {
+		return errNotEncrypted
+	}
+	w.lock()
+	return nil
+}
+
+// openSecrets decrypts the secrets of the wallet file. An encrypted single
+// key wallet is migrated to a seeded wallet under the same passphrase.
+func (w *W) openSecrets(passphrase string) (*secrets, error) {
+	if w.legacy != nil {
+		keyAsB, err := w.legacy.open(passphrase, w.legacy.Address)
+		if err != nil {
+			return nil, err
+		}
+		defer zeroBytes(keyAsB)
+		w.create(newSecrets(newMnemonic(), "", [][]byte{keyAsB}), P256)
+		if err := w.seal(w.data.Secrets, passphrase); err != nil {
+			return nil, err
+		}
+		w.legacy = nil
+		w.lock()
+		return w.openSecrets(passphrase)
+	}
+	plaintext, err := w.data.Encrypted.open(passphrase, w.data.Account)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(plaintext)
+	s := &secrets{}
+	if err := json.Unmarshal(plaintext, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// seal encrypts s into the wallet file and drops the plaintext secrets.
+func (w *W) seal(s *secrets, passphrase string) error {
+	plaintext := utils.ToJson(s)
+	defer zeroBytes(plaintext)
+	e, err := seal(plaintext, w.data.Account, passphrase)
+	if err != nil {
+		return err
+	}
+	w.data.Encrypted = e
+	w.data.Secrets = nil
+	w.persist()
+	return nil
+}
+
+func (w *W) lock() {
+	if w.lockTimer != nil {
+		w.lockTimer.Stop()
+		w.lockTimer = nil
+	}
+	w.unlockId++
+	w.unlockedUntil = time.Time{}
+	w.secrets.wipe()
+	w.secrets = nil
+	w.signer.wipe()
+	w.signer = nil
+	for _, key := range w.keys {
+		key.wipe()
+	}
+	w.keys = nil
+}
@@ -0,0 +1,179 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/fantasticake/simple-coin/utils"
+)
+
+// memFile keeps the wallet file in memory.
+type memFile struct {
+	data []byte
+}
+
+func (f *memFile) ReadFile(name string) ([]byte, error) {
+	return f.data, nil
+}
+
+func (f *memFile) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	f.data = data
+	return nil
+}
+
+func (f *memFile) Stat(name string) (fs.FileInfo, error) {
+	return nil, nil
+}
+
+func (f *memFile) ReadDir(name string) ([]fs.DirEntry, error) {
+	return nil, nil
+}
+
+func (f *memFile) MkdirAll(path string, perm fs.FileMode) error {
+	return nil
+}
+
+func (f *memFile) IsNotExist(err error) bool {
+	return f.data == nil
+}
+
+func TestEncrypt(t *testing.T) {
+	scryptN = 1 << 10
+	f := &memFile{}
+	file = f
+	defer func() {
+		file = osFile{}
+		loaded = make(map[string]*W)
+	}()
+	tw := getTestWallet()
+
+	if err := Encrypt(tw, ""); err != errEmptyPassphrase {
+		t.Errorf("Expected: %v, Got: %v", errEmptyPassphrase, err)
+	}
+	if err := Encrypt(tw, "secret"); err != nil {
+		t.Fatalf("Expected: nil, Got: %v", err)
+	}
+	if !IsEncrypted(tw) || !IsLocked(tw) {
+		t.Error("should be encrypted and locked")
+	}
+	if bytes.Contains(f.data, []byte(tw.data.Account)) == false || bytes.Contains(f.data, []byte("seed")) {
+		t.Error("should persist the sealed secrets only")
+	}
+	if !Owns(tw, tw.Address) {
+		t.Error("should still watch its addresses")
+	}
+	if _, err := Sign("test", tw, tw.Address); err != errLocked {
+		t.Errorf("Expected: %v, Got: %v", errLocked, err)
+	}
+	if err := Encrypt(tw, "other"); err != errAlreadyEncrypted {
+		t.Errorf("Expected: %v, Got: %v", errAlreadyEncrypted, err)
+	}
+
+	t.Run("should unlock with the passphrase", func(t *testing.T) {
+		if err := Unlock(tw, "wrong", time.Minute); err != errWrongPassphrase {
+			t.Errorf("Expected: %v, Got: %v", errWrongPassphrase, err)
+		}
+		if err := Unlock(tw, "secret", time.Minute); err != nil {
+			t.Fatalf("Expected: nil, Got: %v", err)
+		}
+		signature, err := Sign("test", tw, tw.Address)
+		if err != nil || !verifyFor(tw, tw.Address, "test", signature) {
+			t.Errorf("should sign once unlocked, Got: %v", err)
+		}
+	})
+
+	t.Run("should change the passphrase", func(t *testing.T) {
+		if err := ChangePassphrase(tw, "wrong", "new"); err != errWrongPassphrase {
+			t.Errorf("Expected: %v, Got: %v", errWrongPassphrase, err)
+		}
+		if err := ChangePassphrase(tw, "secret", "new"); err != nil {
+			t.Fatalf("Expected: nil, Got: %v", err)
+		}
+		restored := &W{}
+		restored.restore()
+		if restored.Address != tw.Address || !IsLocked(restored) {
+			t.Error("should restore a locked wallet with its address")
+		}
+		if err := Unlock(restored, "secret", time.Minute); err != errWrongPassphrase {
+			t.Errorf("Expected: %v, Got: %v", errWrongPassphrase, err)
+		}
+		if err := Unlock(restored, "new", time.Minute); err != nil {
+			t.Errorf("Expected: nil, Got: %v", err)
+		}
+	})
+
+	t.Run("should restore an encrypted wallet", func(t *testing.T) {
+		loaded = make(map[string]*W)
+		if restored := Wallet(); restored.Address != tw.Address || !IsEncrypted(restored) {
+			t.Errorf("Expected address: %s, Got: %s", tw.Address, restored.Address)
+		}
+	})
+
+	t.Run("should lock again after the timeout", func(t *testing.T) {
+		if err := Unlock(tw, "new", 0); err != errBadTimeout {
+			t.Errorf("Expected: %v, Got: %v", errBadTimeout, err)
+		}
+		if err := Unlock(tw, "new", 20*time.Millisecond); err != nil {
+			t.Fatalf("Expected: nil, Got: %v", err)
+		}
+		if IsLocked(tw) || UnlockedUntil(tw).IsZero() {
+			t.Error("should be unlocked until the timeout")
+		}
+		time.Sleep(50 * time.Millisecond)
+		if !IsLocked(tw) || !UnlockedUntil(tw).IsZero() {
+			t.Error("should lock after the timeout")
+		}
+	})
+
+	t.Run("should lock on request", func(t *testing.T) {
+		Unlock(tw, "new", 20*time.Millisecond)
+		signer, s := tw.signer, tw.secrets
+		if err := Lock(tw); err != nil || !IsLocked(tw) {
+			t.Errorf("should lock, Got: %v", err)
+		}
+		if signer.d != nil {
+			t.Error("should wipe the private key")
+		}
+		wiped := append(append([]byte{}, s.Seed...), s.Mnemonic...)
+		if len(s.Seed) == 0 || !bytes.Equal(wiped, make([]byte, len(wiped))) {
+			t.Error("should zero the decrypted seed and mnemonic")
+		}
+		Unlock(tw, "new", time.Minute)
+		time.Sleep(50 * time.Millisecond)
+		if IsLocked(tw) {
+			t.Error("an older timeout should not lock a later unlock")
+		}
+		Lock(tw)
+	})
+
+	t.Run("should migrate an encrypted single key wallet", func(t *testing.T) {
+		keyAsB, _ := hex.DecodeString(testWallet)
+		oldAddress := legacyAddressOf(testPubKey())
+		e, _ := seal(keyAsB, oldAddress, "old")
+		e.Address = oldAddress
+		f.data = utils.ToJson(e)
+		legacy := &W{}
+		legacy.restore()
+		if legacy.Address != oldAddress || !IsEncrypted(legacy) || !IsLocked(legacy) {
+			t.Fatal("should restore a locked wallet with its address")
+		}
+		if err := Unlock(legacy, "old", time.Minute); err != nil {
+			t.Fatalf("Expected: nil, Got: %v", err)
+		}
+		signature, err := Sign("test", legacy, oldAddress)
+		if err != nil || !verifyFor(legacy, oldAddress, "test", signature) {
+			t.Errorf("should sign for the old address, Got: %v", err)
+		}
+		restored := &W{}
+		restored.restore()
+		if restored.Address != legacy.Address || !Owns(restored, importedAddress()) || !Owns(restored, oldAddress) {
+			t.Error("should persist the migrated wallet")
+		}
+		if err := Unlock(restored, "old", time.Minute); err != nil {
+			t.Errorf("should keep the passphrase, Got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package wallet
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+)
+
+// Keys are derived BIP32 style, following SLIP-10 for the scheme of the
+// wallet: hardened children hash the parent private key, normal children
+// hash the parent public key, so addresses can be derived without the seed.
+const hardened uint32 = 1 << 31
+
+var (
+	errBadExtendedKey = errors.New("Invalid extended key")
+	errHardenedPublic = errors.New("Can't derive a hardened child from a public key")
+	errHardenedOnly   = errors.New("Keys of this type only derive hardened children")
+)
+
+// extendedKey is a key of the tree with its chain code. d is nil for
+// public keys.
+type extendedKey struct {
+	scheme    scheme
+	d         []byte
+	pub       []byte
+	chainCode []byte
+}
+
+func newExtendedKey(s scheme, d []byte, chainCode []byte) *extendedKey {
+	return &extendedKey{scheme: s, d: d, pub: s.publicKey(d), chainCode: chainCode}
+}
+
+func masterKey(s scheme, seed []byte) *extendedKey {
+	mac := hmac.New(sha512.New, s.seedKey())
+	data := seed
+	for {
+		mac.Reset()
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		if d, ok := s.tweakPrivate(nil, sum[:32]); ok {
+			return newExtendedKey(s, d, sum[32:])
+		}
+		data = sum
+	}
+}
+
+func (k *extendedKey) pubBytes() []byte {
+	return k.pub
+}
+
+// child derives the child at index, hardened when index >= hardened.
+func (k *extendedKey) child(index uint32) (*extendedKey, error) {
+	if index < hardened && k.scheme.hardenedOnly() {
+		return nil, errHardenedOnly
+	}
+	if k.d == nil && index >= hardened {
+		return nil, errHardenedPublic
+	}
+	var data []byte
+	if index >= hardened {
+		data = append([]byte{0}, k.d...)
+	} else {
+		data = append([]byte{}, k.pub...)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+	for {
+		mac := hmac.New(sha512.New, k.chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		if k.d != nil {
+			if d, ok := k.scheme.tweakPrivate(k.d, sum[:32]); ok {
+				return newExtendedKey(k.scheme, d, sum[32:]), nil
+			}
+		} else if pub, ok := k.scheme.tweakPublic(k.pub, sum[:32]); ok {
+			return &extendedKey{scheme: k.scheme, pub: pub, chainCode: sum[32:]}, nil
+		}
+		// The derived key is invalid, SLIP-10 retries with the right half.
+		data = binary.BigEndian.AppendUint32(append([]byte{1}, sum[32:]...), index)
+	}
+}
+
+// path derives the descendant at the given indexes.
+func (k *extendedKey) path(indexes ...uint32) (*extendedKey, error) {
+	var err error
+	for _, index := range indexes {
+		k, err = k.child(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+func (k *extendedKey) public() *extendedKey {
+	return &extendedKey{scheme: k.scheme, pub: k.pub, chainCode: k.chainCode}
+}
+
+func (k *extendedKey) sign(digest []byte) []byte {
+	return k.scheme.sign(k.d, digest)
+}
+
+func (k *extendedKey) wipe() {
+	if k == nil {
+		return
+	}
+	zeroBytes(k.d)
+	k.d = nil
+}
+
+// String encodes the public part of k as hex of its compressed public key
+// and chain code.
+func (k *extendedKey) String() string {
+	return hex.EncodeToString(append(append([]byte{}, k.pub...), k.chainCode...))
+}
+
+func parsePublicKey(s scheme, encoded string) (*extendedKey, error) {
+	data, err := hex.DecodeString(encoded)
+	if err != nil || len(data) <= 32 || !s.validPublicKey(data[:len(data)-32]) {
+		return nil, errBadExtendedKey
+	}
+	return &extendedKey{scheme: s, pub: data[:len(data)-32], chainCode: data[len(data)-32:]}, nil
+}
@@ -0,0 +1,49 @@
+package wallet
+
+import (
+	"testing"
+)
+
+func TestChild(t *testing.T) {
+	master := masterKey(schemes[P256], testSeed)
+
+	t.Run("should derive the same public key from either side", func(t *testing.T) {
+		private, err := master.path(hardened, 1, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		account, _ := master.child(hardened)
+		public, err := account.public().path(1, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if private.public().String() != public.String() {
+			t.Errorf("Expected: %s, Got: %s", private.public(), public)
+		}
+	})
+
+	t.Run("should be deterministic", func(t *testing.T) {
+		a, _ := master.child(hardened)
+		b, _ := masterKey(schemes[P256], testSeed).child(hardened)
+		c, _ := master.child(hardened + 1)
+		if a.String() != b.String() || a.String() == c.String() {
+			t.Error("should derive one key per seed and index")
+		}
+	})
+
+	t.Run("should not derive hardened children from a public key", func(t *testing.T) {
+		if _, err := master.public().child(hardened); err != errHardenedPublic {
+			t.Errorf("Expected: %v, Got: %v", errHardenedPublic, err)
+		}
+	})
+
+	t.Run("should parse its own encoding", func(t *testing.T) {
+		parsed, err := parsePublicKey(schemes[P256], master.String())
+		if err != nil || parsed.String() != master.String() {
+			t.Errorf("should parse %s, Got: %v", master, err)
+		}
+		if _, err := parsePublicKey(schemes[P256], "00"); err != errBadExtendedKey {
+			t.Errorf("Expected: %v, Got: %v", errBadExtendedKey, err)
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package wallet
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A node serves several named wallets. The default one lives in walletFile
+// and is always loaded, the others in walletDir, one file each, and are
+// loaded and unloaded by name.
+const DefaultWallet = "default"
+
+var (
+	walletDir  = "wallets"
+	walletName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+	loaded  = make(map[string]*W)
+	loadedM sync.Mutex
+
+	errBadWalletName   = errors.New("Wallet names are 1 to 64 letters, digits, '-' or '_'")
+	errWalletNotFound  = errors.New("Wallet not found")
+	errWalletNotLoaded = errors.New("Wallet is not loaded")
+	errWalletLoaded    = errors.New("Wallet is already loaded")
+	errUnloadDefault   = errors.New("The default wallet can't be unloaded")
+)
+
+// WalletInfo is a wallet file of the node.
+type WalletInfo struct {
+	Name   string `json:"name"`
+	Loaded bool   `json:"loaded"`
+}
+
+func walletPath(name string) (string, error) {
+	if !walletName.MatchString(name) {
+		return "", errBadWalletName
+	}
+	if name == DefaultWallet {
+		return walletFile, nil
+	}
+	return filepath.Join(walletDir, name+".wallet"), nil
+}
+
+// add makes the wallet file of name with setup and loads it.
+func add(name string, setup func(w *W) error) (*W, error) {
+	loadedM.Lock()
+	defer loadedM.Unlock()
+	path, err := walletPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if fileExists(path) {
+		return nil, errWalletExists
+	}
+	added := &W{Name: name, path: path}
+	if err := setup(added); err != nil {
+		return nil, err
+	}
+	added.persist()
+	loaded[name] = added
+	return added, nil
+}
+
+// Load reads the wallet file of name.
+func Load(name string) (*W, error) {
+	if name == DefaultWallet {
+		return Wallet(), nil
+	}
+	loadedM.Lock()
+	defer loadedM.Unlock()
+	path, err := walletPath(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := loaded[name]; ok {
+		return nil, errWalletLoaded
+	}
+	if !fileExists(path) {
+		return nil, errWalletNotFound
+	}
+	w := &W{Name: name, path: path}
+	w.restore()
+	loaded[name] = w
+	return w, nil
+}
+
+// Unload wipes the keys of the wallet named name and forgets it until it
+// is loaded again.
+func Unload(name string) error {
+	if name == DefaultWallet {
+		return errUnloadDefault
+	}
+	loadedM.Lock()
+	defer loadedM.Unlock()
+	w, ok := loaded[name]
+	if !ok {
+		return errWalletNotLoaded
+	}
+	delete(loaded, name)
+	w.m.Lock()
+	defer w.m.Unlock()
+	w.lock()
+	return nil
+}
+
+// Get returns the loaded wallet named name.
+func Get(name string) (*W, error) {
+	if name == DefaultWallet {
+		return Wallet(), nil
+	}
+	loadedM.Lock()
+	defer loadedM.Unlock()
+	w, ok := loaded[name]
+	if !ok {
+		return nil, errWalletNotLoaded
+	}
+	return w, nil
+}
+
+// Loaded returns the loaded wallets by name. It doesn't make the default
+// wallet, so it is empty until some wallet is loaded.
+func Loaded() []*W {
+	loadedM.Lock()
+	defer loadedM.Unlock()
+	var wallets []*W
+	for _, w := range loaded {
+		wallets = append(wallets, w)
+	}
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].Name < wallets[j].Name })
+	return wallets
+}
+
+// List returns the wallet files of the node by name.
+func List() ([]WalletInfo, error) {
+	Wallet()
+	loadedM.Lock()
+	defer loadedM.Unlock()
+	infos := []WalletInfo{{Name: DefaultWallet, Loaded: true}}
+	entries, err := file.ReadDir(walletDir)
+	if err != nil && !file.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".wallet")
+		if entry.IsDir() || name == entry.Name() || name == DefaultWallet || !walletName.MatchString(name) {
+			continue
+		}
+		_, ok := loaded[name]
+		infos = append(infos, WalletInfo{Name: name, Loaded: ok})
+	}
+	sort.Slice(infos[1:], func(i, j int) bool { return infos[i+1].Name < infos[j+1].Name })
+	return infos, nil
+}
@@ -0,0 +1,93 @@
+package wallet
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// memDir keeps every wallet file in memory by path.
+type memDir struct {
+	fstest.MapFS
+}
+
+func (d memDir) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	d.MapFS[name] = &fstest.MapFile{Data: data, Mode: perm}
+	return nil
+}
+
+func (memDir) MkdirAll(path string, perm fs.FileMode) error {
+	return nil
+}
+
+func (memDir) IsNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+func TestManager(t *testing.T) {
+	dir := memDir{fstest.MapFS{}}
+	file = dir
+	loaded = make(map[string]*W)
+	defer func() {
+		file = osFile{}
+		loaded = make(map[string]*W)
+	}()
+
+	if len(Loaded()) != 0 || len(dir.MapFS) != 0 {
+		t.Errorf("should not make the default wallet to list the loaded ones, Got: %d files", len(dir.MapFS))
+	}
+	team, _, err := Create("team", "", P256)
+	if err != nil || team.Address == Wallet().Address {
+		t.Fatalf("should create a wallet of its own, Got: %v", err)
+	}
+	if _, _, err := Create("team", "", P256); err != errWalletExists {
+		t.Errorf("Expected: %v, Got: %v", errWalletExists, err)
+	}
+	if _, _, err := Create("../team", "", P256); err != errBadWalletName {
+		t.Errorf("Expected: %v, Got: %v", errBadWalletName, err)
+	}
+	if got, err := Get("team"); err != nil || got != team {
+		t.Errorf("should get the loaded wallet, Got: %v", err)
+	}
+
+	t.Run("should unload and load wallets", func(t *testing.T) {
+		if err := Unload(DefaultWallet); err != errUnloadDefault {
+			t.Errorf("Expected: %v, Got: %v", errUnloadDefault, err)
+		}
+		if err := Unload("team"); err != nil || !IsLocked(team) {
+			t.Errorf("should unload and wipe the wallet, Got: %v", err)
+		}
+		if _, err := Get("team"); err != errWalletNotLoaded {
+			t.Errorf("Expected: %v, Got: %v", errWalletNotLoaded, err)
+		}
+		if _, err := Load("other"); err != errWalletNotFound {
+			t.Errorf("Expected: %v, Got: %v", errWalletNotFound, err)
+		}
+		reloaded, err := Load("team")
+		if err != nil || reloaded.Address != team.Address || IsLocked(reloaded) {
+			t.Errorf("should load the wallet from its file, Got: %v", err)
+		}
+		if _, err := Load("team"); err != errWalletLoaded {
+			t.Errorf("Expected: %v, Got: %v", errWalletLoaded, err)
+		}
+	})
+
+	t.Run("should list the wallet files", func(t *testing.T) {
+		Create("idle", "", P256)
+		Unload("idle")
+		infos, err := List()
+		expected := []WalletInfo{{DefaultWallet, true}, {"idle", false}, {"team", true}}
+		if err != nil || len(infos) != len(expected) {
+			t.Fatalf("Expected: %v, Got: %v %v", expected, infos, err)
+		}
+		for i := range expected {
+			if infos[i] != expected[i] {
+				t.Errorf("Expected: %v, Got: %v", expected, infos)
+			}
+		}
+		if len(Loaded()) != 2 {
+			t.Errorf("Expected: 2 loaded wallets, Got: %d", len(Loaded()))
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/fantasticake/simple-coin/utils"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Seeds are backed up as BIP39 mnemonics: 256 bits of entropy plus an 8 bit
+// checksum, split into 24 words of 11 bits.
+const (
+	entropyBytes  = 32
+	mnemonicWords = 24
+	seedRounds    = 2048
+)
+
+var (
+	//go:embed english.txt
+	englishWords string
+	wordlist     = strings.Fields(englishWords)
+	wordIndexes  = indexWords(wordlist)
+
+	errBadMnemonic = errors.New("Mnemonic must be 24 words from the English word list with a valid checksum")
+)
+
+func indexWords(words []string) map[string]int {
+	indexes := make(map[string]int, len(words))
+	for i, word := range words {
+		indexes[word] = i
+	}
+	return indexes
+}
+
+func newMnemonic() string {
+	entropy := make([]byte, entropyBytes)
+	_, err := rand.Read(entropy)
+	utils.HandleErr(err)
+	defer zeroBytes(entropy)
+	return entropyToMnemonic(entropy)
+}
+
+func entropyToMnemonic(entropy []byte) string {
+	checksum := sha256.Sum256(entropy)
+	bits := new(big.Int).SetBytes(append(entropy, checksum[0]))
+	words := make([]string, mnemonicWords)
+	mask := big.NewInt(1<<11 - 1)
+	for i := mnemonicWords - 1; i >= 0; i-- {
+		words[i] = wordlist[new(big.Int).And(bits, mask).Int64()]
+		bits.Rsh(bits, 11)
+	}
+	return strings.Join(words, " ")
+}
+
+func mnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) != mnemonicWords {
+		return nil, errBadMnemonic
+	}
+	bits := new(big.Int)
+	for _, word := range words {
+		index, ok := wordIndexes[word]
+		if !ok {
+			return nil, errBadMnemonic
+		}
+		bits.Lsh(bits, 11)
+		bits.Or(bits, big.NewInt(int64(index)))
+	}
+	data := bits.FillBytes(make([]byte, entropyBytes+1))
+	entropy := data[:entropyBytes]
+	if checksum := sha256.Sum256(entropy); checksum[0] != data[entropyBytes] {
+		return nil, errBadMnemonic
+	}
+	return entropy, nil
+}
+
+// normalizeMnemonic checks mnemonic and joins its words with single spaces.
+func normalizeMnemonic(mnemonic string) (string, error) {
+	entropy, err := mnemonicToEntropy(mnemonic)
+	if err != nil {
+		return "", err
+	}
+	defer zeroBytes(entropy)
+	return entropyToMnemonic(entropy), nil
+}
+
+// mnemonicSeed stretches the mnemonic and its optional passphrase into the
+// seed of the key tree.
+func mnemonicSeed(mnemonic string, passphrase string) []byte {
+	return pbkdf2.Key([]byte(mnemonic), []byte("mnemonic"+passphrase), seedRounds, 64, sha512.New)
+}
@@ -0,0 +1,84 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestMnemonic(t *testing.T) {
+	t.Run("should match the BIP39 vectors", func(t *testing.T) {
+		vectors := []struct{ entropy, mnemonic, seed string }{
+			{
+				strings.Repeat("00", 32),
+				strings.Repeat("abandon ", 23) + "art",
+				"bda85446c68413707090a52022edd26a1c9462295029f2e60cd7c4f2bbd3097170af7a4d73245cafa9c3cca8d561a7c3de6f5d4a10be8ed2a5e608d68f92fcc8",
+			},
+			{
+				strings.Repeat("7f", 32),
+				strings.Repeat("legal winner thank year wave sausage worth useful ", 2) + "legal winner thank year wave sausage worth title",
+				"bc09fca1804f7e69da93c2f2028eb238c227f2e9dda30cd63699232578480a4021b146ad717fbb7e451ce9eb835f43620bf5c514db0f8add49f5d121449d3e87",
+			},
+		}
+		for _, vector := range vectors {
+			entropy, _ := hex.DecodeString(vector.entropy)
+			if mnemonic := entropyToMnemonic(entropy); mnemonic != vector.mnemonic {
+				t.Errorf("Expected: %s, Got: %s", vector.mnemonic, mnemonic)
+			}
+			if seed := hex.EncodeToString(mnemonicSeed(vector.mnemonic, "TREZOR")); seed != vector.seed {
+				t.Errorf("Expected: %s, Got: %s", vector.seed, seed)
+			}
+		}
+	})
+
+	t.Run("should round trip the entropy", func(t *testing.T) {
+		mnemonic := newMnemonic()
+		entropy, err := mnemonicToEntropy(mnemonic)
+		if err != nil || entropyToMnemonic(entropy) != mnemonic {
+			t.Errorf("should parse %s, Got: %v", mnemonic, err)
+		}
+	})
+
+	t.Run("should reject bad mnemonics", func(t *testing.T) {
+		for _, mnemonic := range []string{
+			strings.Repeat("abandon ", 24),
+			strings.Repeat("abandon ", 23) + "bitcoin",
+			strings.Repeat("abandon ", 11) + "about",
+		} {
+			if _, err := mnemonicToEntropy(mnemonic); err != errBadMnemonic {
+				t.Errorf("Expected: %v, Got: %v", errBadMnemonic, err)
+			}
+		}
+	})
+}
+
+func TestRestore(t *testing.T) {
+	f := &memFile{}
+	file = f
+	defer func() {
+		file = osFile{}
+		loaded = make(map[string]*W)
+	}()
+
+	created, mnemonic, err := Create(DefaultWallet, "extra", P256)
+	if err != nil {
+		t.Fatalf("Expected: nil, Got: %v", err)
+	}
+	if _, _, err := Create(DefaultWallet, "", P256); err != errWalletExists {
+		t.Errorf("Expected: %v, Got: %v", errWalletExists, err)
+	}
+
+	f.data = nil
+	if _, err := Restore(DefaultWallet, "abandon", "extra", P256); err != errBadMnemonic {
+		t.Errorf("Expected: %v, Got: %v", errBadMnemonic, err)
+	}
+	restored, err := Restore(DefaultWallet, "  "+strings.ReplaceAll(mnemonic, " ", "\n "), "extra", P256)
+	if err != nil || restored.Address != created.Address || !bytes.Contains(f.data, []byte(created.data.Account)) {
+		t.Errorf("should restore the same wallet, Got: %v", err)
+	}
+	f.data = nil
+	if other, _ := Restore(DefaultWallet, mnemonic, "", P256); other.Address == created.Address {
+		t.Error("the passphrase should change the wallet")
+	}
+}
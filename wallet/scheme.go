@@ -0,0 +1,303 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	btcecdsa "github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/fantasticake/simple-coin/utils"
+)
+
+// KeyType selects the signature scheme of a wallet. Addresses carry it, so
+// every output names the scheme that verifies the inputs spending it.
+type KeyType byte
+
+const (
+	P256 KeyType = iota
+	Secp256k1
+	Ed25519
+	Schnorr
+)
+
+var (
+	keyTypeNames = [...]string{"p256", "secp256k1", "ed25519", "schnorr"}
+	schemes      = [...]scheme{p256Scheme{}, secp256k1Scheme{}, ed25519Scheme{}, schnorrScheme{}}
+
+	errBadKeyType = errors.New("Unknown key type, use p256, secp256k1, ed25519 or schnorr")
+)
+
+func (t KeyType) String() string {
+	if int(t) < len(keyTypeNames) {
+		return keyTypeNames[t]
+	}
+	return "unknown"
+}
+
+func (t KeyType) MarshalText() ([]byte, error) {
+	if int(t) >= len(keyTypeNames) {
+		return nil, errBadKeyType
+	}
+	return []byte(t.String()), nil
+}
+
+func (t *KeyType) UnmarshalText(text []byte) error {
+	parsed, err := ParseKeyType(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// ParseKeyType reads the name of a key type.
+func ParseKeyType(name string) (KeyType, error) {
+	for i, keyTypeName := range keyTypeNames {
+		if name == keyTypeName {
+			return KeyType(i), nil
+		}
+	}
+	return 0, errBadKeyType
+}
+
+// scheme signs and verifies with one kind of key and derives its keys the
+// SLIP-10 way. Private keys are 32 bytes, public keys are serialized in
+// their compressed form.
+type scheme interface {
+	// seedKey keys the HMAC turning a seed into the master key.
+	seedKey() []byte
+	// hardenedOnly is set when children can't be derived from public keys.
+	hardenedOnly() bool
+	// tweakPrivate derives a child private key from parent and the left
+	// half of the HMAC, false when that gives no valid key. parent is nil
+	// for the master key.
+	tweakPrivate(parent []byte, tweak []byte) ([]byte, bool)
+	tweakPublic(parent []byte, tweak []byte) ([]byte, bool)
+	publicKey(d []byte) []byte
+	validPublicKey(pubKey []byte) bool
+	sign(d []byte, digest []byte) []byte
+	verify(pubKey []byte, digest []byte, signature []byte) bool
+}
+
+// p256Scheme is ECDSA on NIST P-256 with the canonical signatures of
+// signature.go.
+type p256Scheme struct{}
+
+func (p256Scheme) seedKey() []byte {
+	return []byte("Nist256p1 seed")
+}
+
+func (p256Scheme) hardenedOnly() bool {
+	return false
+}
+
+func (p256Scheme) tweakPrivate(parent []byte, tweak []byte) ([]byte, bool) {
+	n := ec.Params().N
+	d := new(big.Int).SetBytes(tweak)
+	if d.Cmp(n) >= 0 {
+		return nil, false
+	}
+	if parent != nil {
+		d.Add(d, new(big.Int).SetBytes(parent))
+		d.Mod(d, n)
+	}
+	if d.Sign() == 0 {
+		return nil, false
+	}
+	return d.FillBytes(make([]byte, 32)), true
+}
+
+func (p256Scheme) tweakPublic(parent []byte, tweak []byte) ([]byte, bool) {
+	x, y, ok := parseP256Key(parent)
+	if !ok || new(big.Int).SetBytes(tweak).Cmp(ec.Params().N) >= 0 {
+		return nil, false
+	}
+	tx, ty := ec.ScalarBaseMult(tweak)
+	x, y = ec.Add(tx, ty, x, y)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, false
+	}
+	return elliptic.MarshalCompressed(ec, x, y), true
+}
+
+func (p256Scheme) publicKey(d []byte) []byte {
+	x, y := ec.ScalarBaseMult(d)
+	return elliptic.MarshalCompressed(ec, x, y)
+}
+
+func (p256Scheme) validPublicKey(pubKey []byte) bool {
+	_, _, ok := parseP256Key(pubKey)
+	return ok
+}
+
+func (p256Scheme) sign(d []byte, digest []byte) []byte {
+	key := p256Key(d)
+	defer zeroKey(key)
+	return encodeSignature(signDigest(key, digest))
+}
+
+func (p256Scheme) verify(pubKey []byte, digest []byte, signature []byte) bool {
+	x, y, ok := parseP256Key(pubKey)
+	if !ok {
+		return false
+	}
+	r, s, ok := parseSignature(signature)
+	return ok && ecdsa.Verify(&ecdsa.PublicKey{Curve: ec, X: x, Y: y}, digest, r, s)
+}
+
+func p256Key(d []byte) *ecdsa.PrivateKey {
+	x, y := ec.ScalarBaseMult(d)
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: ec, X: x, Y: y},
+		D:         new(big.Int).SetBytes(d),
+	}
+}
+
+// secp256k1Scheme is ECDSA on secp256k1, signing r||s with a low s and
+// RFC 6979 nonces like p256Scheme.
+type secp256k1Scheme struct{}
+
+func (secp256k1Scheme) seedKey() []byte {
+	return []byte("Bitcoin seed")
+}
+
+func (secp256k1Scheme) hardenedOnly() bool {
+	return false
+}
+
+func (secp256k1Scheme) tweakPrivate(parent []byte, tweak []byte) ([]byte, bool) {
+	var d btcec.ModNScalar
+	if d.SetByteSlice(tweak) {
+		return nil, false
+	}
+	if parent != nil {
+		var p btcec.ModNScalar
+		p.SetByteSlice(parent)
+		d.Add(&p)
+	}
+	if d.IsZero() {
+		return nil, false
+	}
+	dAsB := d.Bytes()
+	d.Zero()
+	return dAsB[:], true
+}
+
+func (secp256k1Scheme) tweakPublic(parent []byte, tweak []byte) ([]byte, bool) {
+	pub, err := btcec.ParsePubKey(parent)
+	var t btcec.ModNScalar
+	if err != nil || t.SetByteSlice(tweak) {
+		return nil, false
+	}
+	var tweakPoint, parentPoint, child btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(&t, &tweakPoint)
+	pub.AsJacobian(&parentPoint)
+	btcec.AddNonConst(&tweakPoint, &parentPoint, &child)
+	if child.Z.IsZero() {
+		return nil, false
+	}
+	child.ToAffine()
+	return btcec.NewPublicKey(&child.X, &child.Y).SerializeCompressed(), true
+}
+
+func (secp256k1Scheme) publicKey(d []byte) []byte {
+	key, pub := btcec.PrivKeyFromBytes(d)
+	defer key.Zero()
+	return pub.SerializeCompressed()
+}
+
+func (secp256k1Scheme) validPublicKey(pubKey []byte) bool {
+	_, err := btcec.ParsePubKey(pubKey)
+	return err == nil && len(pubKey) == btcec.PubKeyBytesLenCompressed
+}
+
+func (secp256k1Scheme) sign(d []byte, digest []byte) []byte {
+	key, _ := btcec.PrivKeyFromBytes(d)
+	defer key.Zero()
+	// A compact signature is a recovery byte and r||s with a low s.
+	signature, err := btcecdsa.SignCompact(key, digest, true)
+	utils.HandleErr(err)
+	return signature[1:]
+}
+
+func (secp256k1Scheme) verify(pubKey []byte, digest []byte, signature []byte) bool {
+	pub, err := btcec.ParsePubKey(pubKey)
+	if err != nil || len(signature) != signatureSize {
+		return false
+	}
+	var r, s btcec.ModNScalar
+	if r.SetByteSlice(signature[:signatureSize/2]) || s.SetByteSlice(signature[signatureSize/2:]) {
+		return false
+	}
+	if r.IsZero() || s.IsZero() || s.IsOverHalfOrder() {
+		return false
+	}
+	return btcecdsa.NewSignature(&r, &s).Verify(digest, pub)
+}
+
+// schnorrScheme signs BIP340 Schnorr signatures with secp256k1 keys.
+type schnorrScheme struct {
+	secp256k1Scheme
+}
+
+func (schnorrScheme) sign(d []byte, digest []byte) []byte {
+	key, _ := btcec.PrivKeyFromBytes(d)
+	defer key.Zero()
+	signature, err := schnorr.Sign(key, digest)
+	utils.HandleErr(err)
+	return signature.Serialize()
+}
+
+func (schnorrScheme) verify(pubKey []byte, digest []byte, signature []byte) bool {
+	pub, err := btcec.ParsePubKey(pubKey)
+	if err != nil {
+		return false
+	}
+	parsed, err := schnorr.ParseSignature(signature)
+	return err == nil && parsed.Verify(digest, pub)
+}
+
+// ed25519Scheme signs Ed25519 signatures. SLIP-10 only derives hardened
+// Ed25519 keys.
+type ed25519Scheme struct{}
+
+func (ed25519Scheme) seedKey() []byte {
+	return []byte("ed25519 seed")
+}
+
+func (ed25519Scheme) hardenedOnly() bool {
+	return true
+}
+
+func (ed25519Scheme) tweakPrivate(parent []byte, tweak []byte) ([]byte, bool) {
+	return append([]byte{}, tweak...), true
+}
+
+func (ed25519Scheme) tweakPublic(parent []byte, tweak []byte) ([]byte, bool) {
+	return nil, false
+}
+
+func (ed25519Scheme) publicKey(d []byte) []byte {
+	key := ed25519.NewKeyFromSeed(d)
+	defer zeroBytes(key)
+	return append([]byte{}, key[ed25519.SeedSize:]...)
+}
+
+func (ed25519Scheme) validPublicKey(pubKey []byte) bool {
+	return len(pubKey) == ed25519.PublicKeySize
+}
+
+func (ed25519Scheme) sign(d []byte, digest []byte) []byte {
+	key := ed25519.NewKeyFromSeed(d)
+	defer zeroBytes(key)
+	return ed25519.Sign(key, digest)
+}
+
+func (ed25519Scheme) verify(pubKey []byte, digest []byte, signature []byte) bool {
+	return len(pubKey) == ed25519.PublicKeySize && len(signature) == ed25519.SignatureSize &&
+		ed25519.Verify(pubKey, digest, signature)
+}
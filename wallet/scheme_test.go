@@ -0,0 +1,124 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestMasterKey(t *testing.T) {
+	// Test vector 1 of SLIP-10, which is BIP32's for secp256k1.
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	tests := []struct {
+		keyType   KeyType
+		private   string
+		chainCode string
+	}{
+		{Secp256k1, "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35", "873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508"},
+		{Ed25519, "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7", "90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb"},
+	}
+	for _, test := range tests {
+		master := masterKey(schemes[test.keyType], seed)
+		if hex.EncodeToString(master.d) != test.private || hex.EncodeToString(master.chainCode) != test.chainCode {
+			t.Errorf("%s Expected: %s %s, Got: %x %x", test.keyType, test.private, test.chainCode, master.d, master.chainCode)
+		}
+	}
+
+	t.Run("should derive public children of secp256k1 keys", func(t *testing.T) {
+		master := masterKey(schemes[Secp256k1], seed)
+		private, _ := master.path(hardened, 1)
+		// m/0H/1 of the same vector.
+		if hex.EncodeToString(private.d) != "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368" {
+			t.Errorf("Expected: 3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368, Got: %x", private.d)
+		}
+		account, _ := master.child(hardened)
+		public, err := account.public().child(1)
+		if err != nil || hex.EncodeToString(private.pub) != hex.EncodeToString(public.pub) {
+			t.Errorf("should derive the same public key from either side, Got: %v", err)
+		}
+	})
+
+	t.Run("should only derive hardened ed25519 keys", func(t *testing.T) {
+		if _, err := masterKey(schemes[Ed25519], seed).child(0); err != errHardenedOnly {
+			t.Errorf("Expected: %v, Got: %v", errHardenedOnly, err)
+		}
+	})
+}
+
+func TestSchemes(t *testing.T) {
+	file = &memFile{}
+	defer func() { file = osFile{} }()
+	wallets := map[KeyType]*W{}
+	for keyType := range keyTypeNames {
+		wallets[KeyType(keyType)] = getTestWalletOf(KeyType(keyType))
+	}
+
+	for keyType, tw := range wallets {
+		t.Run("should sign with "+keyType.String(), func(t *testing.T) {
+			if parsed, _, err := decodeAddress(tw.Address); err != nil || parsed != keyType {
+				t.Errorf("Expected: %s, Got: %s %v", keyType, parsed, err)
+			}
+			change, _ := ChangeAddress(tw)
+			signature, err := Sign("test", tw, change)
+			if err != nil || !verifyFor(tw, change, "test", signature) {
+				t.Errorf("should verify its signature, Got: %v", err)
+			}
+			again, _ := Sign("test", tw, change)
+			if again != signature {
+				t.Error("should sign deterministically")
+			}
+			if verifyFor(tw, change, "test2", signature) {
+				t.Error("should return false for different data")
+			}
+		})
+	}
+
+	t.Run("should verify with the scheme of the address", func(t *testing.T) {
+		ecdsaWallet, schnorrWallet := wallets[Secp256k1], wallets[Schnorr]
+		pubKey, _ := PublicKey(schnorrWallet, schnorrWallet.Address)
+		signature, _ := Sign("test", ecdsaWallet, ecdsaWallet.Address)
+		if Verify(schnorrWallet.Address, pubKey, "test", signature) {
+			t.Error("should not verify an ECDSA signature as Schnorr")
+		}
+	})
+}
+
+func TestHardenedOnlyWallet(t *testing.T) {
+	scryptN = 1 << 10
+	f := &memFile{}
+	file = f
+	defer func() {
+		file = osFile{}
+		loaded = make(map[string]*W)
+	}()
+	tw := getTestWalletOf(Ed25519)
+	if err := Encrypt(tw, "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	locked := &W{}
+	locked.restore()
+	if locked.Address != tw.Address || len(Addresses(locked)) != 1 {
+		t.Error("should watch the addresses kept in the file while locked")
+	}
+	var change string
+	for i := 0; i < gapLimit; i++ {
+		var err error
+		if change, err = ChangeAddress(locked); err != nil {
+			t.Fatalf("should hand out kept addresses, Got: %v", err)
+		}
+		ClaimChange(locked, change)
+	}
+	if _, err := ChangeAddress(locked); err != errGapLimit {
+		t.Errorf("Expected: %v, Got: %v", errGapLimit, err)
+	}
+	MarkUsed(locked, change)
+	if _, err := ChangeAddress(locked); err != errLocked {
+		t.Errorf("Expected: %v, Got: %v", errLocked, err)
+	}
+	if err := Unlock(locked, "secret", 60e9); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ChangeAddress(locked); err != nil {
+		t.Errorf("should derive more addresses once unlocked, Got: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"math/big"
+)
+
+// Signatures are r||s as two 32 byte numbers with s in the lower half of
+// the curve order, so each one has a single encoding. They sign the
+// SHA-256 of the hash with a nonce derived from the key and message as in
+// RFC 6979.
+const signatureSize = 64
+
+func messageDigest(hash string) []byte {
+	sum := sha256.Sum256([]byte(hash))
+	return sum[:]
+}
+
+// bits2int reads a digest as a number of at most the order's bit length.
+func bits2int(data []byte, n *big.Int) *big.Int {
+	i := new(big.Int).SetBytes(data)
+	if excess := len(data)*8 - n.BitLen(); excess > 0 {
+		i.Rsh(i, uint(excess))
+	}
+	return i
+}
+
+// nonces yields the RFC 6979 candidates for k until one is accepted.
+func nonces(key *ecdsa.PrivateKey, digest []byte, accept func(k *big.Int) bool) {
+	n := key.Curve.Params().N
+	size := (n.BitLen() + 7) / 8
+	x := key.D.FillBytes(make([]byte, size))
+	defer zeroBytes(x)
+	h := new(big.Int).Mod(bits2int(digest, n), n).FillBytes(make([]byte, size))
+
+	mac := func(k []byte, parts ...[]byte) []byte {
+		m := hmac.New(sha256.New, k)
+		for _, part := range parts {
+			m.Write(part)
+		}
+		return m.Sum(nil)
+	}
+	v := make([]byte, sha256.Size)
+	for i := range v {
+		v[i] = 1
+	}
+	k := make([]byte, sha256.Size)
+	k = mac(k, v, []byte{0}, x, h)
+	v = mac(k, v)
+	k = mac(k, v, []byte{1}, x, h)
+	v = mac(k, v)
+	for {
+		var t []byte
+		for len(t) < size {
+			v = mac(k, v)
+			t = append(t, v...)
+		}
+		candidate := bits2int(t[:size], n)
+		if candidate.Sign() > 0 && candidate.Cmp(n) < 0 && accept(candidate) {
+			return
+		}
+		k = mac(k, v, []byte{0})
+		v = mac(k, v)
+	}
+}
+
+// signDigest signs digest with key deterministically, with a low s.
+func signDigest(key *ecdsa.PrivateKey, digest []byte) (*big.Int, *big.Int) {
+	n := key.Curve.Params().N
+	e := bits2int(digest, n)
+	var r, s *big.Int
+	nonces(key, digest, func(k *big.Int) bool {
+		x, _ := key.Curve.ScalarBaseMult(k.FillBytes(make([]byte, 32)))
+		r = new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			return false
+		}
+		s = new(big.Int).Mul(r, key.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, n))
+		s.Mod(s, n)
+		return s.Sign() != 0
+	})
+	if s.Cmp(halfOrder(n)) > 0 {
+		s.Sub(n, s)
+	}
+	return r, s
+}
+
+func halfOrder(n *big.Int) *big.Int {
+	return new(big.Int).Rsh(n, 1)
+}
+
+func encodeSignature(r, s *big.Int) []byte {
+	data := make([]byte, signatureSize)
+	r.FillBytes(data[:signatureSize/2])
+	s.FillBytes(data[signatureSize/2:])
+	return data
+}
+
+// parseSignature reads a canonical signature, refusing any other encoding
+// of it.
+func parseSignature(data []byte) (*big.Int, *big.Int, bool) {
+	if len(data) != signatureSize {
+		return nil, nil, false
+	}
+	n := ec.Params().N
+	r := new(big.Int).SetBytes(data[:signatureSize/2])
+	s := new(big.Int).SetBytes(data[signatureSize/2:])
+	if r.Sign() == 0 || r.Cmp(n) >= 0 || s.Sign() == 0 || s.Cmp(halfOrder(n)) > 0 {
+		return nil, nil, false
+	}
+	return r, s, true
+}
@@ -0,0 +1,62 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestSignDigest(t *testing.T) {
+	t.Run("should derive the RFC 6979 nonce", func(t *testing.T) {
+		// A.2.5 of RFC 6979, P-256 with SHA-256 and the message "sample".
+		d, _ := new(big.Int).SetString("C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721", 16)
+		x, y := ec.ScalarBaseMult(d.Bytes())
+		key := &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: ec, X: x, Y: y}, D: d}
+		digest := sha256.Sum256([]byte("sample"))
+
+		r, s := signDigest(key, digest[:])
+		wantR, _ := new(big.Int).SetString("EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716", 16)
+		wantS, _ := new(big.Int).SetString("F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8", 16)
+		// The vector's s is high, so it is negated.
+		wantS.Sub(ec.Params().N, wantS)
+		if r.Cmp(wantR) != 0 || s.Cmp(wantS) != 0 {
+			t.Errorf("Expected: %x %x, Got: %x %x", wantR, wantS, r, s)
+		}
+	})
+
+	t.Run("should be deterministic and canonical", func(t *testing.T) {
+		tw := getTestWallet()
+		a, _ := Sign("test", tw, tw.Address)
+		b, _ := Sign("test", tw, tw.Address)
+		if a != b || len(a) != signatureSize*2 {
+			t.Errorf("should sign the same 64 bytes twice, Got: %s %s", a, b)
+		}
+		if data, _ := hex.DecodeString(a); !parses(data) {
+			t.Errorf("should parse its own signature %s", a)
+		}
+	})
+}
+
+func TestParseSignature(t *testing.T) {
+	key := testKey()
+	r, s := signDigest(key, messageDigest("test"))
+	n := ec.Params().N
+	high := new(big.Int).Sub(n, s)
+	for name, signature := range map[string][]byte{
+		"high s":    encodeSignature(r, high),
+		"short":     encodeSignature(r, s)[1:],
+		"zero r":    encodeSignature(big.NewInt(0), s),
+		"r too big": encodeSignature(n, s),
+	} {
+		if parses(signature) {
+			t.Errorf("should reject a signature with %s", name)
+		}
+	}
+}
+
+func parses(signature []byte) bool {
+	_, _, ok := parseSignature(signature)
+	return ok
+}
@@ -1,16 +1,17 @@
 package wallet
 
 import (
-	"crypto/ecdsa"
 	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/x509"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
-	"math/big"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/fantasticake/simple-coin/utils"
 )
@@ -19,6 +20,8 @@ type fileLayer interface {
 	ReadFile(name string) ([]byte, error)
 	WriteFile(name string, data []byte, perm fs.FileMode) error
 	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	MkdirAll(path string, perm fs.FileMode) error
 	IsNotExist(err error) bool
 }
 
@@ -36,97 +39,573 @@ func (osFile) Stat(name string) (fs.FileInfo, error) {
 	return os.Stat(name)
 }
 
+func (osFile) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osFile) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
 func (osFile) IsNotExist(err error) bool {
 	return os.IsNotExist(err)
 }
 
+// The wallet derives its addresses from a single seed. Receive addresses
+// live at m/0'/0/i and change addresses at m/0'/1/i, hardened for key types
+// that only derive hardened keys.
+const (
+	receiveChain  = 0
+	changeChain   = 1
+	importedChain = -1
+	watchedChain  = -2
+)
+
+var (
+	gapLimit = 20
+
+	errGapLimit     = errors.New("Too many unused addresses, use one before asking for another")
+	errWalletExists = errors.New("Wallet file already exists, move it away first")
+)
+
+// secrets are what an encrypted wallet file seals: the mnemonic backing up
+// the seed, the seed and the keys imported from older single key wallets,
+// as hex DER.
+type secrets struct {
+	Mnemonic secret   `json:"mnemonic,omitempty"`
+	Seed     secret   `json:"seed"`
+	Keys     []secret `json:"keys,omitempty"`
+}
+
+// walletData is the wallet file. Account is the public key of m/0' and
+// Imported the public keys of imported keys, so addresses can be watched
+// while the wallet is locked. Key types that can't derive public keys keep
+// those of their addresses in PubKeys instead. Next counts the addresses
+// handed out on each chain and Used is one past the last address seen on
+// chain. Watched are the addresses followed without keys, and a WatchOnly
+// wallet has no keys at all.
+type walletData struct {
+	KeyType   KeyType       `json:"keyType"`
+	Account   string        `json:"account"`
+	Next      [2]int        `json:"next"`
+	Used      [2]int        `json:"used"`
+	PubKeys   [2][]string   `json:"pubKeys,omitempty"`
+	Imported  []string      `json:"importedKeys,omitempty"`
+	Watched   []watched     `json:"watched,omitempty"`
+	WatchOnly bool          `json:"watchOnly,omitempty"`
+	Secrets   *secrets      `json:"secrets,omitempty"`
+	Encrypted *encryptedKey `json:"encrypted,omitempty"`
+}
+
+// keyPath locates the key of an address. Legacy addresses are the hex
+// form of the same keys, still watched so older coins stay spendable.
+type keyPath struct {
+	chain  int
+	index  int
+	legacy bool
+}
+
+// AddressInfo is an address handed out by the wallet.
+type AddressInfo struct {
+	Address   string `json:"address"`
+	Path      string `json:"path"`
+	WatchOnly bool   `json:"watchOnly,omitempty"`
+}
+
 type W struct {
-	privateKey *ecdsa.PrivateKey
-	Address    string
+	Name          string
+	Address       string
+	path          string
+	data          walletData
+	account       *extendedKey
+	chains        [2][]string
+	paths         map[string]keyPath
+	signer        *extendedKey
+	secrets       *secrets
+	keys          map[string]*extendedKey
+	legacy        *encryptedKey
+	unlockedUntil time.Time
+	lockTimer     *time.Timer
+	unlockId      int
+	reserved      map[int]bool
+	m             sync.Mutex
 }
 
 var (
 	file       fileLayer      = osFile{}
 	walletFile string         = "simple_coin.wallet"
 	ec         elliptic.Curve = elliptic.P256()
-	w          *W
-	once       sync.Once
 )
 
+// Wallet returns the default wallet, loading or making it on first use.
 func Wallet() *W {
-	once.Do(func() {
-		w = &W{}
-		if fileExists(walletFile) {
-			w.restore()
-		} else {
-			w.init()
-		}
-	})
+	loadedM.Lock()
+	defer loadedM.Unlock()
+	if w, ok := loaded[DefaultWallet]; ok {
+		return w
+	}
+	w := &W{Name: DefaultWallet, path: walletFile}
+	if fileExists(walletFile) {
+		w.restore()
+	} else {
+		w.init()
+	}
+	loaded[DefaultWallet] = w
 	return w
 }
 
-func Sign(hash string, w *W) string {
-	r, s, err := ecdsa.Sign(rand.Reader, w.privateKey, utils.ToBytes(hash))
-	utils.HandleErr(err)
-	return fmt.Sprintf("%x", append(r.Bytes(), s.Bytes()...))
+// Create makes a new wallet of keyType named name, loads it and returns it
+// with the mnemonic backing it up. passphrase is optional and needed along
+// with the words to restore it.
+func Create(name string, passphrase string, keyType KeyType) (*W, string, error) {
+	mnemonic := newMnemonic()
+	created, err := add(name, withSecrets(newSecrets(mnemonic, passphrase, nil), keyType))
+	if err != nil {
+		return nil, "", err
+	}
+	return created, mnemonic, nil
 }
 
-func Verify(addr, hash, signature string) bool {
-	x, y := bigIntsByHexStr(addr)
-	pub := ecdsa.PublicKey{
-		Curve: ec,
-		X:     x,
-		Y:     y,
+// Restore rebuilds the wallet named name of keyType from its mnemonic and
+// passphrase and loads it. It only knows its first addresses until the
+// chain is rescanned for the used ones.
+func Restore(name string, mnemonic string, passphrase string, keyType KeyType) (*W, error) {
+	mnemonic, err := normalizeMnemonic(mnemonic)
+	if err != nil {
+		return nil, err
 	}
-	r, s := bigIntsByHexStr(signature)
-	return ecdsa.Verify(&pub, utils.ToBytes(hash), r, s)
+	return add(name, withSecrets(newSecrets(mnemonic, passphrase, nil), keyType))
 }
 
-func bigIntsByHexStr(data string) (*big.Int, *big.Int) {
-	dataAsB, err := hex.DecodeString(data)
-	utils.HandleErr(err)
-	x := big.Int{}
-	y := big.Int{}
-	x.SetBytes(dataAsB[:len(dataAsB)/2])
-	y.SetBytes(dataAsB[len(dataAsB)/2:])
-	return &x, &y
+// withSecrets sets a new wallet up from s.
+func withSecrets(s *secrets, keyType KeyType) func(w *W) error {
+	return func(w *W) error {
+		w.create(s, keyType)
+		return nil
+	}
+}
+
+// KeyTypeOf returns the key type of the addresses the wallet hands out.
+func KeyTypeOf(w *W) KeyType {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.data.KeyType
+}
+
+// Sign signs hash with the key of address.
+func Sign(hash string, w *W, address string) (string, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.data.WatchOnly {
+		return "", errWatchOnly
+	}
+	if w.signer == nil {
+		return "", errLocked
+	}
+	key, err := w.privateKey(address)
+	if err != nil {
+		return "", err
+	}
+	defer key.wipe()
+	return hex.EncodeToString(key.sign(messageDigest(hash))), nil
+}
+
+// Owns reports whether the wallet can spend from address.
+func Owns(w *W, address string) bool {
+	w.m.Lock()
+	defer w.m.Unlock()
+	path, ok := w.paths[address]
+	return ok && !w.data.WatchOnly && path.chain != watchedChain
+}
+
+// Addresses lists the addresses handed out so far, imported and watched
+// ones last.
+func Addresses(w *W) []AddressInfo {
+	w.m.Lock()
+	defer w.m.Unlock()
+	var infos []AddressInfo
+	if w.account != nil {
+		mark := ""
+		if w.account.scheme.hardenedOnly() {
+			mark = "'"
+		}
+		for chain := range w.chains {
+			for index := 0; index < w.issued(chain) && index < len(w.chains[chain]); index++ {
+				infos = append(infos, AddressInfo{
+					Address:   w.chains[chain][index],
+					Path:      fmt.Sprintf("m/0'/%d%s/%d%s", chain, mark, index, mark),
+					WatchOnly: w.data.WatchOnly,
+				})
+			}
+		}
+	}
+	for _, pubKey := range w.data.Imported {
+		pubKeyAsB, _ := hex.DecodeString(pubKey)
+		infos = append(infos, AddressInfo{Address: encodeAddress(P256, pubKeyAsB), Path: "imported"})
+	}
+	for _, watched := range w.data.Watched {
+		infos = append(infos, AddressInfo{Address: watched.Address, Path: "watched", WatchOnly: true})
+	}
+	return infos
+}
+
+// NewAddress hands out the next receive address. It refuses to run more
+// than the gap limit ahead of the last used address, so a restored wallet
+// always finds its coins.
+func NewAddress(w *W) (string, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.data.Next[receiveChain] >= w.data.Used[receiveChain]+gapLimit {
+		return "", errGapLimit
+	}
+	return w.nextAddress(receiveChain)
+}
+
+// ChangeAddress reserves the next free change address, so concurrent
+// sends each get their own. ClaimChange hands it out once the transaction
+// is signed and ReleaseChange gives it back if it isn't. Change stays
+// within the gap limit too, so a restored wallet finds it.
+func ChangeAddress(w *W) (string, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.account == nil {
+		return "", errNoAccount
+	}
+	index := w.issued(changeChain)
+	for w.reserved[index] {
+		index++
+	}
+	if index >= w.data.Used[changeChain]+gapLimit {
+		return "", errGapLimit
+	}
+	if index >= len(w.chains[changeChain]) {
+		return "", errLocked
+	}
+	if w.reserved == nil {
+		w.reserved = make(map[int]bool)
+	}
+	w.reserved[index] = true
+	return w.chains[changeChain][index], nil
+}
+
+// ClaimChange hands out a change address ChangeAddress reserved.
+func ClaimChange(w *W, address string) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	path, ok := w.paths[address]
+	if !ok || path.chain != changeChain {
+		return
+	}
+	delete(w.reserved, path.index)
+	if path.index >= w.issued(changeChain) {
+		w.claim(changeChain, path.index)
+	}
+}
+
+// ReleaseChange gives back a change address ChangeAddress reserved for a
+// transaction that was never sent.
+func ReleaseChange(w *W, address string) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	if path, ok := w.paths[address]; ok && path.chain == changeChain {
+		delete(w.reserved, path.index)
+	}
+}
+
+// PublicKey returns the compressed public key spenders of address reveal,
+// empty for legacy addresses.
+func PublicKey(w *W, address string) (string, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	path, ok := w.paths[address]
+	if !ok {
+		return "", errUnknownAddress
+	}
+	if path.legacy {
+		return "", nil
+	}
+	if path.chain == watchedChain {
+		return w.data.Watched[path.index].PubKey, nil
+	}
+	if path.chain == importedChain {
+		return w.data.Imported[path.index], nil
+	}
+	pubKey, err := w.publicKey(path.chain, path.index)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(pubKey), nil
+}
+
+// MarkUsed records that address received coins, moving the gap limit
+// window past it.
+func MarkUsed(w *W, address string) {
+	w.m.Lock()
+	defer w.m.Unlock()
+	path, ok := w.paths[address]
+	if !ok || path.chain < 0 || path.index < w.data.Used[path.chain] {
+		return
+	}
+	w.data.Used[path.chain] = path.index + 1
+	if w.data.Next[path.chain] <= path.index {
+		w.data.Next[path.chain] = path.index + 1
+	}
+	w.watch()
+	w.persist()
+}
+
+func (w *W) issued(chain int) int {
+	if w.data.Next[chain] > w.data.Used[chain] {
+		return w.data.Next[chain]
+	}
+	return w.data.Used[chain]
+}
+
+// nextAddress hands out the next address of chain.
+func (w *W) nextAddress(chain int) (string, error) {
+	address, err := w.peekAddress(chain)
+	if err != nil {
+		return "", err
+	}
+	w.claim(chain, w.issued(chain))
+	return address, nil
+}
+
+// peekAddress returns the next address of chain. Key types that can't
+// derive public keys run out of them while the wallet is locked.
+func (w *W) peekAddress(chain int) (string, error) {
+	if w.account == nil {
+		return "", errNoAccount
+	}
+	index := w.issued(chain)
+	if index >= len(w.chains[chain]) {
+		return "", errLocked
+	}
+	return w.chains[chain][index], nil
+}
+
+// claim hands out the addresses of chain up to index.
+func (w *W) claim(chain int, index int) {
+	w.data.Next[chain] = index + 1
+	w.watch()
+	w.persist()
+}
+
+// watch derives the addresses of each chain up to the gap limit past the
+// last used one, as far as the keys at hand allow.
+func (w *W) watch() {
+	if w.paths == nil {
+		w.paths = make(map[string]keyPath)
+	}
+	keyType := w.data.KeyType
+	cached := len(w.data.PubKeys[receiveChain]) + len(w.data.PubKeys[changeChain])
+	for chain := range w.chains {
+		for index := len(w.chains[chain]); w.account != nil && index < w.issued(chain)+gapLimit; index++ {
+			pubKey, err := w.publicKey(chain, index)
+			if err == errLocked {
+				break
+			}
+			utils.HandleErr(err)
+			address := encodeAddress(keyType, pubKey)
+			w.chains[chain] = append(w.chains[chain], address)
+			w.paths[address] = keyPath{chain, index, false}
+			if keyType == P256 {
+				w.paths[legacyAddressOf(pubKey)] = keyPath{chain, index, true}
+			}
+		}
+	}
+	for index, pubKey := range w.data.Imported {
+		pubKeyAsB, err := hex.DecodeString(pubKey)
+		if err != nil || !schemes[P256].validPublicKey(pubKeyAsB) {
+			continue
+		}
+		w.paths[encodeAddress(P256, pubKeyAsB)] = keyPath{importedChain, index, false}
+		w.paths[legacyAddressOf(pubKeyAsB)] = keyPath{importedChain, index, true}
+	}
+	w.watchImported()
+	if len(w.chains[receiveChain]) > 0 {
+		w.Address = w.chains[receiveChain][0]
+	} else if len(w.data.Watched) > 0 {
+		w.Address = w.data.Watched[0].Address
+	}
+	if cached != len(w.data.PubKeys[receiveChain])+len(w.data.PubKeys[changeChain]) {
+		w.persist()
+	}
+}
+
+// keyIndexes is the path below the account of the key at index of chain.
+func (w *W) keyIndexes(chain int, index int) []uint32 {
+	if w.account.scheme.hardenedOnly() {
+		return []uint32{hardened + uint32(chain), hardened + uint32(index)}
+	}
+	return []uint32{uint32(chain), uint32(index)}
+}
+
+// publicKey derives the public key at index of chain, from the account
+// when the key type allows and else from the signer, keeping it in the
+// wallet file for while it is locked.
+func (w *W) publicKey(chain int, index int) ([]byte, error) {
+	if !w.account.scheme.hardenedOnly() {
+		key, err := w.account.path(w.keyIndexes(chain, index)...)
+		if err != nil {
+			return nil, err
+		}
+		return key.pubBytes(), nil
+	}
+	if index < len(w.data.PubKeys[chain]) {
+		return hex.DecodeString(w.data.PubKeys[chain][index])
+	}
+	if w.signer == nil || index != len(w.data.PubKeys[chain]) {
+		return nil, errLocked
+	}
+	key, err := w.signer.path(w.keyIndexes(chain, index)...)
+	if err != nil {
+		return nil, err
+	}
+	key.wipe()
+	w.data.PubKeys[chain] = append(w.data.PubKeys[chain], hex.EncodeToString(key.pubBytes()))
+	return key.pubBytes(), nil
+}
+
+// privateKey returns a copy of the key of address for the caller to wipe.
+func (w *W) privateKey(address string) (*extendedKey, error) {
+	path, ok := w.paths[address]
+	if !ok {
+		return nil, errUnknownAddress
+	}
+	if path.chain == watchedChain {
+		return nil, errWatchOnly
+	}
+	if path.chain == importedChain {
+		key := w.keys[w.data.Imported[path.index]]
+		return &extendedKey{scheme: key.scheme, d: append([]byte{}, key.d...), pub: key.pub}, nil
+	}
+	return w.signer.path(w.keyIndexes(path.chain, path.index)...)
 }
 
 func (w *W) restore() {
-	w.restoreKey()
-	w.calcAddr()
+	dataAsB, err := file.ReadFile(w.path)
+	utils.HandleErr(err)
+	if len(dataAsB) == 0 || dataAsB[0] != '{' {
+		w.migrate(dataAsB)
+		return
+	}
+	if e, ok := parseEncryptedKey(dataAsB); ok {
+		// Encrypted single key wallets migrate on their first unlock.
+		w.legacy = e
+		w.Address = e.Address
+		w.paths = map[string]keyPath{e.Address: {importedChain, 0, true}}
+		return
+	}
+	utils.HandleErr(json.Unmarshal(dataAsB, &w.data))
+	if w.data.Account != "" {
+		w.account, err = parsePublicKey(schemes[w.data.KeyType], w.data.Account)
+		utils.HandleErr(err)
+	}
+	w.watch()
+	if w.data.Secrets != nil {
+		utils.HandleErr(w.unlockSecrets(w.data.Secrets))
+	}
 }
 
-func (w *W) calcAddr() {
-	xAsB := w.privateKey.X.Bytes()
-	yAsB := w.privateKey.Y.Bytes()
-	w.Address = fmt.Sprintf("%x", append(xAsB, yAsB...))
+// migrate turns a plaintext single key wallet into a seeded wallet that
+// keeps the old key as an imported one.
+func (w *W) migrate(keyAsB []byte) {
+	_, err := x509.ParseECPrivateKey(keyAsB)
+	utils.HandleErr(err)
+	w.create(newSecrets(newMnemonic(), "", [][]byte{keyAsB}), P256)
+	w.persist()
 }
 
 func (w *W) init() {
-	w.createKey()
-	persistKey(w.privateKey)
-	w.calcAddr()
+	w.create(newSecrets(newMnemonic(), "", nil), P256)
+	w.persist()
 }
 
-func (w *W) createKey() {
-	key, err := ecdsa.GenerateKey(ec, rand.Reader)
-	utils.HandleErr(err)
-	w.privateKey = key
+// newSecrets derives the seed of mnemonic and passphrase and keeps the
+// imported DER keys along.
+func newSecrets(mnemonic string, passphrase string, keys [][]byte) *secrets {
+	seed := mnemonicSeed(mnemonic, passphrase)
+	defer zeroBytes(seed)
+	s := &secrets{Mnemonic: secret(mnemonic), Seed: hexSecret(seed)}
+	for _, keyAsB := range keys {
+		s.Keys = append(s.Keys, hexSecret(keyAsB))
+	}
+	return s
 }
 
-func (w *W) restoreKey() {
-	keyAsB, err := file.ReadFile(walletFile)
+// create sets up a plaintext wallet of keyType from s.
+func (w *W) create(s *secrets, keyType KeyType) {
+	seed, err := s.Seed.decodeHex()
 	utils.HandleErr(err)
-	key, err := x509.ParseECPrivateKey(keyAsB)
+	defer zeroBytes(seed)
+	master := masterKey(schemes[keyType], seed)
+	defer master.wipe()
+	account, err := master.child(hardened)
 	utils.HandleErr(err)
-	w.privateKey = key
+	defer account.wipe()
+	// The first receive address is the wallet address.
+	w.data = walletData{
+		KeyType: keyType,
+		Account: account.public().String(),
+		Next:    [2]int{1, 0},
+		Secrets: s,
+	}
+	w.account = account.public()
+	w.chains = [2][]string{}
+	w.paths = nil
+	utils.HandleErr(w.unlockSecrets(s))
 }
 
-func persistKey(key *ecdsa.PrivateKey) {
-	keyAsB, err := x509.MarshalECPrivateKey(key)
-	utils.HandleErr(err)
-	utils.HandleErr(file.WriteFile(walletFile, keyAsB, 0700))
+// unlockSecrets loads the signing keys from s.
+func (w *W) unlockSecrets(s *secrets) error {
+	seed, err := s.Seed.decodeHex()
+	if err != nil {
+		return errBadExtendedKey
+	}
+	defer zeroBytes(seed)
+	master := masterKey(w.account.scheme, seed)
+	defer master.wipe()
+	signer, err := master.child(hardened)
+	if err != nil {
+		return err
+	}
+	if signer.public().String() != w.data.Account {
+		signer.wipe()
+		return errBadExtendedKey
+	}
+	keys := make(map[string]*extendedKey)
+	imported := []string{}
+	for _, keyAsHex := range s.Keys {
+		keyAsB, err := keyAsHex.decodeHex()
+		if err != nil {
+			return errBadExtendedKey
+		}
+		key, err := x509.ParseECPrivateKey(keyAsB)
+		zeroBytes(keyAsB)
+		if err != nil {
+			return err
+		}
+		pubKey := elliptic.MarshalCompressed(ec, key.X, key.Y)
+		keys[hex.EncodeToString(pubKey)] = &extendedKey{
+			scheme: schemes[P256],
+			d:      key.D.FillBytes(make([]byte, 32)),
+			pub:    pubKey,
+		}
+		imported = append(imported, hex.EncodeToString(pubKey))
+		zeroKey(key)
+	}
+	w.signer = signer
+	w.keys = keys
+	w.secrets = s
+	w.data.Imported = imported
+	w.watch()
+	return nil
+}
+
+func (w *W) persist() {
+	utils.HandleErr(file.MkdirAll(filepath.Dir(w.path), 0700))
+	utils.HandleErr(file.WriteFile(w.path, utils.ToJson(w.data), 0600))
 }
 
 func fileExists(filename string) bool {
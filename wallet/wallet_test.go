@@ -1,10 +1,12 @@
 package wallet
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/x509"
 	"encoding/hex"
 	"io/fs"
-	"sync"
+	"strings"
 	"testing"
 )
 
@@ -28,18 +30,57 @@ func (testFile) Stat(name string) (fs.FileInfo, error) {
 	return nil, nil
 }
 
+func (testFile) ReadDir(name string) ([]fs.DirEntry, error) {
+	return nil, nil
+}
+
+func (testFile) MkdirAll(path string, perm fs.FileMode) error {
+	return nil
+}
+
 func (t testFile) IsNotExist(err error) bool {
 	return t.FakeIsNotExist(err)
 }
 
+var (
+	testSeed     = []byte("simple coin test seed, 32 bytes!")
+	testMnemonic = strings.Repeat("abandon ", 23) + "art"
+)
+
+// getTestWallet is a plaintext P256 wallet restored from testMnemonic.
 func getTestWallet() *W {
+	return getTestWalletOf(P256)
+}
+
+// getTestWalletOf is a plaintext wallet of keyType restored from
+// testMnemonic.
+func getTestWalletOf(keyType KeyType) *W {
+	tw := &W{}
+	tw.create(newSecrets(testMnemonic, "", nil), keyType)
+	return tw
+}
+
+func testKey() *ecdsa.PrivateKey {
 	keyAsB, _ := hex.DecodeString(testWallet)
 	key, _ := x509.ParseECPrivateKey(keyAsB)
-	tw := W{
-		privateKey: key,
-	}
-	tw.calcAddr()
-	return &tw
+	return key
+}
+
+// testPubKey is the compressed public key of testKey.
+func testPubKey() []byte {
+	key := testKey()
+	return elliptic.MarshalCompressed(ec, key.X, key.Y)
+}
+
+// importedAddress is the address of the single key wallet in testWallet.
+func importedAddress() string {
+	return encodeAddress(P256, testPubKey())
+}
+
+// verifyFor verifies signature with the public key w reveals for address.
+func verifyFor(w *W, address, hash, signature string) bool {
+	pubKey, err := PublicKey(w, address)
+	return err == nil && Verify(address, pubKey, hash, signature)
 }
 
 func TestWallet(t *testing.T) {
@@ -48,38 +89,120 @@ func TestWallet(t *testing.T) {
 			FakeIsNotExist: func(err error) bool { return true },
 		}
 		tw := Wallet()
-		if tw.privateKey == nil {
-			t.Errorf("privateKey should be created")
+		if IsLocked(tw) {
+			t.Errorf("keys should be created")
 		}
 		if tw.Address == "" {
 			t.Errorf("address should be calculated")
 		}
 	})
 
-	t.Run("should restore wallet", func(t *testing.T) {
+	t.Run("should migrate a single key wallet", func(t *testing.T) {
 		file = testFile{
 			FakeIsNotExist: func(err error) bool { return false },
 		}
-		once = sync.Once{}
+		loaded = make(map[string]*W)
 		tw := Wallet()
-		if tw.Address != getTestWallet().Address {
-			t.Errorf("should restore address, Expected: %v, Got: %v", getTestWallet().Address, tw.Address)
+		if !Owns(tw, importedAddress()) {
+			t.Errorf("should import the old key, Expected: %v", importedAddress())
+		}
+		signature, err := Sign("test", tw, importedAddress())
+		if err != nil || !verifyFor(tw, importedAddress(), "test", signature) {
+			t.Errorf("should sign with the old key, Got: %v", err)
 		}
 	})
 }
 
 func TestSign(t *testing.T) {
-	signature := Sign("test", getTestWallet())
-	ok := Verify(getTestWallet().Address, "test", signature)
+	tw := getTestWallet()
+	signature, _ := Sign("test", tw, tw.Address)
+	ok := verifyFor(tw, tw.Address, "test", signature)
 	if !ok {
 		t.Error("should return correct signature")
 	}
+	if _, err := Sign("test", tw, importedAddress()); err != errUnknownAddress {
+		t.Errorf("Expected: %v, Got: %v", errUnknownAddress, err)
+	}
 }
 
 func TestVerify(t *testing.T) {
-	signature := Sign("test", getTestWallet())
-	ok := Verify(getTestWallet().Address, "test2", signature)
+	tw := getTestWallet()
+	signature, _ := Sign("test", tw, tw.Address)
+	ok := verifyFor(tw, tw.Address, "test2", signature)
 	if ok {
 		t.Error("should return false for different data")
 	}
 }
+
+func TestAddresses(t *testing.T) {
+	f := &memFile{}
+	file = f
+	defer func() { file = osFile{} }()
+	tw := getTestWallet()
+	if tw.Address != getTestWallet().Address {
+		t.Fatal("should derive the same addresses from the same seed")
+	}
+
+	t.Run("should hand out fresh addresses", func(t *testing.T) {
+		address, err := NewAddress(tw)
+		if err != nil || address == tw.Address || !Owns(tw, address) {
+			t.Errorf("should hand out a new owned address, Got: %v", err)
+		}
+		change, err := ChangeAddress(tw)
+		if err != nil || change == address || !Owns(tw, change) {
+			t.Error("should hand out an owned change address")
+		}
+		other, _ := ChangeAddress(tw)
+		if other == change {
+			t.Error("should not hand out a reserved change address twice")
+		}
+		ReleaseChange(tw, other)
+		if again, _ := ChangeAddress(tw); again != other {
+			t.Error("should hand out a released change address again")
+		}
+		ReleaseChange(tw, other)
+		ClaimChange(tw, change)
+		if next, _ := ChangeAddress(tw); next != other {
+			t.Errorf("Expected: %s, Got: %s", other, next)
+		}
+		signature, _ := Sign("test", tw, change)
+		if !verifyFor(tw, change, "test", signature) {
+			t.Error("should sign with a change address")
+		}
+		if len(Addresses(tw)) != 3 {
+			t.Errorf("Expected: 3 addresses, Got: %v", Addresses(tw))
+		}
+	})
+
+	t.Run("should respect the gap limit", func(t *testing.T) {
+		var last string
+		var err error
+		for err == nil {
+			address := last
+			last, err = NewAddress(tw)
+			if err != nil {
+				last = address
+			}
+		}
+		if err != errGapLimit {
+			t.Fatalf("Expected: %v, Got: %v", errGapLimit, err)
+		}
+		MarkUsed(tw, last)
+		if _, err := NewAddress(tw); err != nil {
+			t.Errorf("should hand out addresses past a used one, Got: %v", err)
+		}
+	})
+
+	t.Run("should restore the addresses", func(t *testing.T) {
+		restored := &W{}
+		restored.restore()
+		if len(Addresses(restored)) != len(Addresses(tw)) {
+			t.Errorf("Expected: %d addresses, Got: %d", len(Addresses(tw)), len(Addresses(restored)))
+		}
+		for _, info := range Addresses(tw) {
+			if !Owns(restored, info.Address) {
+				t.Errorf("should own %s", info.Path)
+			}
+		}
+	})
+}
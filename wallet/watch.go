@@ -0,0 +1,132 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+// Watched addresses are followed for their coins without a key, so a node
+// can track cold storage. A watch-only wallet holds no private keys at all,
+// it derives the addresses of another wallet from its account public key.
+type watched struct {
+	Address string `json:"address"`
+	PubKey  string `json:"pubKey,omitempty"`
+}
+
+var (
+	errWatchOnly    = errors.New("Wallet is watch-only and holds no private keys")
+	errNoAccount    = errors.New("Wallet has no account key to derive addresses from")
+	errKnownAddress = errors.New("Address is already in the wallet")
+	errBadPubKey    = errors.New("Invalid public key")
+)
+
+// CreateWatchOnly makes a wallet named name without private keys and loads
+// it. account is the account key of a wallet of keyType, see AccountKey, to
+// watch every address it derives. It is empty for a wallet of imported
+// addresses only.
+func CreateWatchOnly(name string, account string, keyType KeyType) (*W, error) {
+	return add(name, func(w *W) error {
+		if account != "" {
+			parsed, err := parsePublicKey(schemes[keyType], account)
+			if err != nil {
+				return err
+			}
+			if parsed.scheme.hardenedOnly() {
+				return errHardenedOnly
+			}
+			w.account = parsed
+		}
+		w.data = walletData{
+			KeyType:   keyType,
+			Account:   account,
+			Next:      [2]int{1, 0},
+			WatchOnly: true,
+		}
+		w.watch()
+		return nil
+	})
+}
+
+// IsWatchOnly reports whether the wallet holds no private keys.
+func IsWatchOnly(w *W) bool {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.data.WatchOnly
+}
+
+// AccountKey returns the public key and chain code of m/0', from which a
+// watch-only wallet derives the same addresses.
+func AccountKey(w *W) string {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.data.Account
+}
+
+// Watches reports whether the wallet follows the coins of address, whether
+// or not it can spend them.
+func Watches(w *W, address string) bool {
+	w.m.Lock()
+	defer w.m.Unlock()
+	_, ok := w.paths[address]
+	return ok
+}
+
+// ImportAddress watches address without a key.
+func ImportAddress(w *W, address string) error {
+	if err := ValidateAddress(address); err != nil {
+		return err
+	}
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.importWatched(watched{Address: address})
+}
+
+// ImportPubKey watches the address of a public key of keyType without its
+// private key, and returns it. P-256 keys also watch their legacy address.
+func ImportPubKey(w *W, pubKey string, keyType KeyType) (string, error) {
+	pubKeyAsB, ok := decodeHex(pubKey)
+	if !ok || !schemes[keyType].validPublicKey(pubKeyAsB) {
+		return "", errBadPubKey
+	}
+	address := encodeAddress(keyType, pubKeyAsB)
+	w.m.Lock()
+	defer w.m.Unlock()
+	return address, w.importWatched(watched{Address: address, PubKey: pubKey})
+}
+
+func (w *W) importWatched(entry watched) error {
+	// Encrypted single key wallets only get a wallet file on their first
+	// unlock.
+	if w.legacy != nil {
+		return errLocked
+	}
+	if _, ok := w.paths[entry.Address]; ok {
+		return errKnownAddress
+	}
+	w.data.Watched = append(w.data.Watched, entry)
+	w.watch()
+	w.persist()
+	return nil
+}
+
+// watchImported adds the watched addresses to those of the wallet, unless
+// its own keys already own them.
+func (w *W) watchImported() {
+	for index, entry := range w.data.Watched {
+		if _, ok := w.paths[entry.Address]; !ok {
+			w.paths[entry.Address] = keyPath{watchedChain, index, false}
+		}
+		keyType, _, err := decodeAddress(entry.Address)
+		if entry.PubKey == "" || err != nil || keyType != P256 {
+			continue
+		}
+		pubKeyAsB, err := hex.DecodeString(entry.PubKey)
+		if err != nil {
+			continue
+		}
+		legacy := legacyAddressOf(pubKeyAsB)
+		if _, ok := w.paths[legacy]; !ok {
+			w.paths[legacy] = keyPath{watchedChain, index, true}
+		}
+	}
+}
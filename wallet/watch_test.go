@@ -0,0 +1,90 @@
+package wallet
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestWatchOnly(t *testing.T) {
+	file = memDir{fstest.MapFS{}}
+	loaded = make(map[string]*W)
+	defer func() {
+		file = osFile{}
+		loaded = make(map[string]*W)
+	}()
+	cold := getTestWalletOf(Secp256k1)
+	change, _ := ChangeAddress(cold)
+
+	watcher, err := CreateWatchOnly("watcher", AccountKey(cold), Secp256k1)
+	if err != nil || watcher.Address != cold.Address || !IsWatchOnly(watcher) {
+		t.Fatalf("should derive the addresses of the account, Got: %v", err)
+	}
+	if !Watches(watcher, change) || Owns(watcher, change) {
+		t.Error("should watch the change addresses without owning them")
+	}
+	if _, err := Sign("test", watcher, cold.Address); err != errWatchOnly {
+		t.Errorf("Expected: %v, Got: %v", errWatchOnly, err)
+	}
+	if err := Encrypt(watcher, "secret"); err != errWatchOnly {
+		t.Errorf("Expected: %v, Got: %v", errWatchOnly, err)
+	}
+	if _, err := CreateWatchOnly("ed", AccountKey(getTestWalletOf(Ed25519)), Ed25519); err != errHardenedOnly {
+		t.Errorf("Expected: %v, Got: %v", errHardenedOnly, err)
+	}
+
+	t.Run("should watch imported addresses only", func(t *testing.T) {
+		addresses, err := CreateWatchOnly("addresses", "", P256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewAddress(addresses); err != errNoAccount {
+			t.Errorf("Expected: %v, Got: %v", errNoAccount, err)
+		}
+		if err := ImportAddress(addresses, change); err != nil || addresses.Address != change {
+			t.Errorf("should watch the address, Got: %v", err)
+		}
+		Unload("addresses")
+		reloaded, err := Load("addresses")
+		if err != nil || !Watches(reloaded, change) || !IsWatchOnly(reloaded) {
+			t.Errorf("should keep the watched addresses in the file, Got: %v", err)
+		}
+	})
+}
+
+func TestImport(t *testing.T) {
+	file = &memFile{}
+	defer func() { file = osFile{} }()
+	tw := getTestWallet()
+	cold := getTestWalletOf(Schnorr)
+	pubKey, _ := PublicKey(cold, cold.Address)
+
+	if err := ImportAddress(tw, "bad"); err != errBadAddress {
+		t.Errorf("Expected: %v, Got: %v", errBadAddress, err)
+	}
+	if err := ImportAddress(tw, tw.Address); err != errKnownAddress {
+		t.Errorf("Expected: %v, Got: %v", errKnownAddress, err)
+	}
+	if _, err := ImportPubKey(tw, pubKey, Ed25519); err != errBadPubKey {
+		t.Errorf("Expected: %v, Got: %v", errBadPubKey, err)
+	}
+	address, err := ImportPubKey(tw, pubKey, Schnorr)
+	if err != nil || address != cold.Address {
+		t.Fatalf("Expected: %s, Got: %s %v", cold.Address, address, err)
+	}
+	if !Watches(tw, address) || Owns(tw, address) || !Owns(tw, tw.Address) {
+		t.Error("should watch the key without owning it")
+	}
+	if _, err := Sign("test", tw, address); err != errWatchOnly {
+		t.Errorf("Expected: %v, Got: %v", errWatchOnly, err)
+	}
+	infos := Addresses(tw)
+	if last := infos[len(infos)-1]; last.Address != address || !last.WatchOnly {
+		t.Errorf("should list the address as watch-only, Got: %v", last)
+	}
+
+	restored := &W{}
+	restored.restore()
+	if !Watches(restored, address) || restored.Address != tw.Address {
+		t.Error("should keep the watched address in the file")
+	}
+}